@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const alertsKey = "alerts"
+
+// alertRearm - how far back past its threshold a price has to go, as a
+// fraction of the threshold, before an alert can fire again. Stops a price
+// sitting on the line from DMing someone every few minutes
+const alertRearm = 0.02
+
+// priceAlert - a rule to DM someone when a share goes above or below a
+// price, or moves more than Value percent in a day
+type priceAlert struct {
+	Symbol string    `json:"symbol"`
+	Kind   string    `json:"kind"`
+	Value  float64   `json:"value"`
+	Fired  bool      `json:"fired"`
+	Last   time.Time `json:"last,omitempty"`
+}
+
+func (a *priceAlert) String() string {
+	if a.Kind == "move" {
+		return fmt.Sprintf("%s moves %g%% in a day", a.Symbol, a.Value)
+	}
+	return fmt.Sprintf("%s goes %s $%.2f", a.Symbol, a.Kind, a.Value)
+}
+
+// triggered is whether the quote crosses the threshold, and rearmed whether
+// it is far enough back the other way to fire again
+func (a *priceAlert) check(q quote) (triggered bool, rearmed bool) {
+	switch a.Kind {
+	case "above":
+		return q.Price >= a.Value, q.Price < a.Value*(1-alertRearm)
+	case "below":
+		return q.Price <= a.Value, q.Price > a.Value*(1+alertRearm)
+	case "move":
+		move := math.Abs(q.PercentChange)
+		return move >= a.Value, move < a.Value*(1-alertRearm)
+	}
+	return false, false
+}
+
+// alert handles eg.
+//
+//	alert atm nzx above 4.50
+//	alert xro asx move 5%
+//	alerts
+//	cancel alert 2
+func (s *server) alert(user, text string) (string, error) {
+	words := strings.Fields(text)
+	switch {
+	case len(words) == 1 || (len(words) == 2 && words[0] == "my"):
+		return s.listAlerts(user)
+	case words[0] == "cancel":
+		return s.cancelAlert(user, words[len(words)-1])
+	}
+
+	words = words[1:]
+	kind := -1
+	for i, w := range words {
+		if w == "above" || w == "below" || w == "move" {
+			kind = i
+		}
+	}
+	if kind < 1 || kind != len(words)-2 {
+		return "Try something like alert atm nzx above 4.50 or alert xro asx move 5%", nil
+	}
+	symbol := strings.Join(words[:kind], " ")
+	value, err := strconv.ParseFloat(strings.Trim(words[kind+1], "$%"), 64)
+	if err != nil || value <= 0 {
+		return "I don't know what " + words[kind+1] + " is, try something like 4.50 or 5%", nil
+	}
+
+	_, err = s.quotes.Quote(symbol)
+	if isSymbolNotFound(err) {
+		return "I couldn't find a share called " + symbol + ", try something like alert atm nzx above 4.50", nil
+	}
+	if isBadSymbol(err) {
+		return err.Error() + ", try something like alert atm nzx above 4.50", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	a := &priceAlert{Symbol: symbol, Kind: words[kind], Value: value}
+	alerts := make(map[string][]*priceAlert)
+	err = s.store.update(alertsKey, &alerts, func() error {
+		alerts[user] = append(alerts[user], a)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "I'll let you know when " + a.String(), nil
+}
+
+func (s *server) listAlerts(user string) (string, error) {
+	alerts := make(map[string][]*priceAlert)
+	err := s.store.load(alertsKey, &alerts)
+	if err != nil {
+		return "", err
+	}
+	if len(alerts[user]) == 0 {
+		return "You don't have any alerts, try alert atm nzx above 4.50", nil
+	}
+
+	var r strings.Builder
+	r.WriteString("Your alerts:\n")
+	for i, a := range alerts[user] {
+		r.WriteString(strconv.Itoa(i+1) + ". " + a.String())
+		if a.Fired {
+			r.WriteString(" (fired " + formatDue(a.Last) + ")")
+		}
+		r.WriteString("\n")
+	}
+	r.WriteString("Cancel one with cancel alert <number>")
+	return r.String(), nil
+}
+
+func (s *server) cancelAlert(user, number string) (string, error) {
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return "Tell me which alert, eg. cancel alert 2", nil
+	}
+
+	var cancelled *priceAlert
+	alerts := make(map[string][]*priceAlert)
+	err = s.store.update(alertsKey, &alerts, func() error {
+		if n < 1 || n > len(alerts[user]) {
+			return nil
+		}
+		cancelled = alerts[user][n-1]
+		alerts[user] = append(alerts[user][:n-1], alerts[user][n:]...)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if cancelled == nil {
+		return "You don't have an alert " + number + ", see your alerts with alerts", nil
+	}
+	return "I won't tell you when " + cancelled.String() + " any more", nil
+}
+
+// checkAlerts looks up each share once and DMs anyone whose alert fired
+func (s *server) checkAlerts(now time.Time) error {
+	alerts := make(map[string][]*priceAlert)
+	err := s.store.load(alertsKey, &alerts)
+	if err != nil {
+		return err
+	}
+
+	quotes := make(map[string]quote)
+	for _, as := range alerts {
+		for _, a := range as {
+			if _, ok := quotes[a.Symbol]; ok {
+				continue
+			}
+			// prices don't move while the market is shut
+			if e := exchangeFor(a.Symbol); e != nil && !e.isOpen(now) {
+				continue
+			}
+			q, err := s.quotes.Quote(a.Symbol)
+			if err != nil {
+				fmt.Printf("Error: %s\n", err)
+				continue
+			}
+			quotes[a.Symbol] = q
+		}
+	}
+
+	dms := make(map[string][]string)
+	err = s.store.update(alertsKey, &alerts, func() error {
+		for user, as := range alerts {
+			for _, a := range as {
+				q, ok := quotes[a.Symbol]
+				if !ok {
+					continue
+				}
+				triggered, rearmed := a.check(q)
+				if a.Fired && rearmed {
+					a.Fired = false
+				}
+				if !a.Fired && triggered {
+					a.Fired = true
+					a.Last = now
+					dms[user] = append(dms[user], ":rotating_light: "+q.String()+", you wanted to know when "+a.String())
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for user, texts := range dms {
+		s.sendDM(user, strings.Join(texts, "\n"))
+	}
+	return nil
+}
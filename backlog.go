@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// the lists every backlog backend has to provide
+const (
+	ideasList     = "ideas"
+	scheduledList = "scheduled"
+	meetupsList   = "meetups"
+)
+
+// backlogItem - a talk idea, scheduled talk or meetup
+type backlogItem struct {
+	ID          string     `json:"id"`
+	List        string     `json:"list"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	Due         *time.Time `json:"due,omitempty"`
+}
+
+// backlog - where talk ideas, scheduled talks and meetups are kept
+type backlog interface {
+	Items(list string) ([]backlogItem, error)
+	Create(list string, item *backlogItem) error
+	Move(id, list string) error
+	SetDue(id string, due *time.Time) error
+}
+
+func newBacklog(cfg backlogConfig, trello TrelloClient, cache *listCache) (backlog, error) {
+	switch cfg.Backend {
+	case "", "trello":
+		return &trelloBacklog{client: trello, cache: cache}, nil
+	case "file":
+		if cfg.File == "" {
+			return nil, errors.New("The file backlog needs a file")
+		}
+		return &fileBacklog{path: cfg.File}, nil
+	case "github":
+		if cfg.Repo == "" {
+			return nil, errors.New("The github backlog needs a repo")
+		}
+		return newGitHubBacklog(&http.Client{}, cfg.Repo, cfg.token), nil
+	}
+	return nil, errors.Errorf("Unknown backlog backend: %s", cfg.Backend)
+}
+
+func findItem(items []backlogItem, id string) (int, error) {
+	for i := range items {
+		if items[i].ID == id {
+			return i, nil
+		}
+	}
+	return -1, errors.Errorf("Could not find backlog item: %s", id)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+const cacheTTL = 5 * time.Minute
+
+// listCache sits in front of getCards so we don't make two trello calls for
+// every command. Stale lists are served while they are refreshed in the
+// background, and kept if trello is unavailable, so an outage or rate limit
+// doesn't take the bot down with it.
+type listCache struct {
+	client TrelloClient
+	clock  clock
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	lists map[string]*cachedList
+	// generations goes up each time a list is invalidated, so a fetch that
+	// started before then doesn't overwrite the invalidation with old cards
+	generations map[string]int
+}
+
+// cachedList - failed is when trello last failed us, we wait out the ttl
+// before trying again
+type cachedList struct {
+	cards      []*trello.Card
+	fetched    time.Time
+	failed     time.Time
+	invalid    bool
+	refreshing bool
+}
+
+func newListCache(client TrelloClient, clock clock, ttl time.Duration) *listCache {
+	return &listCache{
+		client:      client,
+		clock:       clock,
+		ttl:         ttl,
+		lists:       make(map[string]*cachedList),
+		generations: make(map[string]int),
+	}
+}
+
+func (c *listCache) getCards(listID string) ([]*trello.Card, error) {
+	c.mu.Lock()
+	now := c.clock.Now()
+	l, ok := c.lists[listID]
+	backingOff := ok && now.Sub(l.failed) < c.ttl
+	if !ok || (l.invalid && !backingOff) {
+		c.mu.Unlock()
+		return c.refresh(listID)
+	}
+
+	if now.Sub(l.fetched) > c.ttl && !l.refreshing && !backingOff {
+		l.refreshing = true
+		go func() {
+			if _, err := c.refresh(listID); err != nil {
+				fmt.Printf("Error: %s\n", err)
+			}
+		}()
+	}
+	cards := l.cards
+	c.mu.Unlock()
+
+	return cards, nil
+}
+
+// refresh fetches the list from trello, falling back to whatever we already
+// have if that fails
+func (c *listCache) refresh(listID string) ([]*trello.Card, error) {
+	c.mu.Lock()
+	gen := c.generations[listID]
+	c.generations[listID] = gen
+	c.mu.Unlock()
+
+	cards, err := getCards(c.client, listID)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, ok := c.lists[listID]
+	if err != nil {
+		if ok {
+			l.refreshing = false
+			l.failed = c.clock.Now()
+			fmt.Printf("Error: serving stale cards for list %s: %s\n", listID, err)
+			return l.cards, nil
+		}
+		return nil, err
+	}
+
+	if c.generations[listID] != gen {
+		// invalidated while we were fetching, leave it for the next read
+		if ok {
+			l.refreshing = false
+		}
+		return cards, nil
+	}
+	c.lists[listID] = &cachedList{cards: cards, fetched: c.clock.Now()}
+	return cards, nil
+}
+
+// invalidate makes the next read go to trello, the cached cards are still
+// used if that read fails
+func (c *listCache) invalidate(listIDs ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(listIDs) == 0 {
+		for id := range c.generations {
+			listIDs = append(listIDs, id)
+		}
+	}
+	for _, id := range listIDs {
+		c.generations[id]++
+		if l, ok := c.lists[id]; ok {
+			l.invalid = true
+		}
+	}
+}
@@ -5,36 +5,418 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+// passenger - someone who needs a ride, Date is YYYY-MM-DD
 type passenger struct {
 	Name    string
 	Address string
+	User    string
+	Date    string
 }
 
-func getPassengers(client *http.Client) (string, error) {
-	resp, err := client.Get("http://prod.j22cbjqtiv.us-east-1.elasticbeanstalk.com/passengers")
+// driver - someone offering seats in their car
+type driver struct {
+	Name    string
+	Address string
+	User    string
+	Date    string
+	Seats   int
+	Time    string
+}
+
+// carpoolGroup - a driver and who they are picking up
+type carpoolGroup struct {
+	Driver     driver
+	Passengers []passenger
+}
+
+// carpoolService - where carpool offers and requests are kept, adding
+// someone again for the same day replaces what they said before
+type carpoolService interface {
+	Passengers(day time.Time) ([]passenger, error)
+	Drivers(day time.Time) ([]driver, error)
+	AddPassenger(p passenger) error
+	AddDriver(d driver) error
+	Remove(user string, day time.Time) error
+}
+
+// newCarpoolService keeps carpools in rudolph's store, unless it has been
+// pointed at a carpool service
+func newCarpoolService(cfg carpoolConfig, client *http.Client, st *store) carpoolService {
+	if cfg.local() {
+		return &storeCarpool{store: st}
+	}
+	return newCarpoolClient(client, cfg.URL)
+}
+
+// errCarpoolReadOnly - the carpool service can only list who needs a ride
+var errCarpoolReadOnly = errors.New("The carpool service can only tell me who needs a ride, ask whoever runs me to keep carpools myself")
+
+// carpoolClient - talks to the carpool service, which only has GET /passengers
+type carpoolClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+var (
+	carpoolTime  = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	carpoolSeats = regexp.MustCompile(`^(\d+)$`)
+)
+
+func newCarpoolClient(client *http.Client, baseURL string) *carpoolClient {
+	return &carpoolClient{client: client, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Passengers is everyone the service has, it doesn't know about days so
+// only those who gave a different date are left out
+func (c *carpoolClient) Passengers(day time.Time) ([]passenger, error) {
+	u := c.baseURL + "/passengers"
+	resp, err := c.client.Get(u)
 	if err != nil {
-		return "", errors.Wrap(err, fmt.Sprintf("Could not make request to get passengers"))
+		return nil, errors.Wrapf(err, "Could not make request to %s", u)
 	}
 
 	data, err := ioutil.ReadAll(resp.Body)
 	defer resp.Body.Close()
 	if err != nil {
-		return "", errors.Wrapf(err, "Could not read request to get passengers")
+		return nil, errors.Wrapf(err, "Could not read request for %s", u)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Carpool returned %d for %s", resp.StatusCode, u)
 	}
 
+	var all []passenger
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not deserialise request for %s", u)
+	}
 	var p []passenger
-	e := json.Unmarshal(data, &p)
-	if e != nil {
-		return "", errors.Wrapf(e, "Could not deserialise request to get passengers")
+	for _, pa := range all {
+		if pa.Date == "" || pa.Date == day.Format("2006-01-02") {
+			p = append(p, pa)
+		}
+	}
+	return p, nil
+}
+
+func (c *carpoolClient) Drivers(day time.Time) ([]driver, error) {
+	return nil, errCarpoolReadOnly
+}
+
+func (c *carpoolClient) AddPassenger(p passenger) error {
+	return errCarpoolReadOnly
+}
+
+func (c *carpoolClient) AddDriver(d driver) error {
+	return errCarpoolReadOnly
+}
+
+func (c *carpoolClient) Remove(user string, day time.Time) error {
+	return errCarpoolReadOnly
+}
+
+// carpool handles eg.
+//
+//	carpool offer 3 seats from ponsonby 8am
+//	carpool need ride from mt eden on friday
+//	carpool matches tomorrow
+//	carpool home ponsonby
+func (s *server) carpool(user, text string, now time.Time) (string, error) {
+	words := strings.Fields(strings.TrimPrefix(text, "carpool"))
+	if len(words) == 0 {
+		return carpoolHelp, nil
+	}
+
+	switch words[0] {
+	case "offer":
+		d, err := parseCarpool(words[1:], now)
+		if err != nil {
+			return err.Error(), nil
+		}
+		if d.seats == 0 || d.suburb == "" {
+			return "Tell me how many seats and where from, eg. carpool offer 3 seats from Ponsonby 8am", nil
+		}
+		err = s.carpools.AddDriver(driver{Name: "<@" + user + ">", User: user, Address: d.suburb, Date: d.date(), Seats: d.seats, Time: d.at})
+		if err == errCarpoolReadOnly {
+			return err.Error(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := s.setCarpoolHome(user, d); err != nil {
+			fmt.Printf("Error: %s\n", err)
+		}
+		return fmt.Sprintf("Thanks <@%s>, you're down for %d %s from %s%s on %s", user, d.seats, plural(d.seats, "seat"), d.suburb, d.atSuffix(), d.dayName()), nil
+
+	case "need":
+		d, err := parseCarpool(words[1:], now)
+		if err != nil {
+			return err.Error(), nil
+		}
+		if d.suburb == "" {
+			d.suburb = s.carpoolHome(user).Suburb
+		} else if err := s.setCarpoolHome(user, d); err != nil {
+			fmt.Printf("Error: %s\n", err)
+		}
+		err = s.carpools.AddPassenger(passenger{Name: "<@" + user + ">", User: user, Address: d.suburb, Date: d.date()})
+		if err == errCarpoolReadOnly {
+			return err.Error(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Got it <@%s>, you need a ride on %s. Ask me for carpool matches to see who's driving", user, d.dayName()), nil
+
+	case "matches":
+		d, err := parseCarpool(words[1:], now)
+		if err != nil {
+			return err.Error(), nil
+		}
+		return s.carpoolMatches(d.day)
+
+	case "home":
+		d, err := parseCarpool(append([]string{"from"}, words[1:]...), now)
+		if err != nil || d.suburb == "" {
+			return "Tell me your suburb, eg. carpool home Ponsonby", nil
+		}
+		return "Thanks <@" + user + ">, I'll use " + d.suburb + " when you sign up for a carpool", s.setCarpoolHome(user, d)
+	}
+	return carpoolHelp, nil
+}
+
+const carpoolHelp = "Try carpool offer 3 seats from Ponsonby 8am, carpool need ride from Mt Eden tomorrow, carpool matches friday or carpool home Ponsonby"
+
+// getPassengers answers eg. who wants to carpool tomorrow
+func (s *server) getPassengers(text string, now time.Time) (string, error) {
+	d, err := parseCarpool(strings.Fields(strings.TrimPrefix(text, "who wants to carpool")), now)
+	if err != nil {
+		return err.Error(), nil
+	}
+
+	p, err := s.carpools.Passengers(d.day)
+	if err != nil {
+		return "", err
+	}
+	if len(p) == 0 {
+		return "Nobody needs a ride on " + d.dayName(), nil
 	}
 
 	var r = "Your choices are:\n"
 	for i := range p {
-		r = r + p[i].Name + " from " + p[i].Address + "\n"
+		r = r + p[i].Name + " from " + p[i].addressOrUnknown() + "\n"
 	}
 	return r, nil
 }
+
+func (s *server) carpoolMatches(day time.Time) (string, error) {
+	groups, left, err := s.matchCarpools(day)
+	if err == errCarpoolReadOnly {
+		return err.Error(), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(groups) == 0 {
+		return "Nobody is driving on " + day.Format("Mon 2 Jan") + " yet", nil
+	}
+
+	var r strings.Builder
+	r.WriteString("Carpools for " + day.Format("Mon 2 Jan") + ":\n")
+	for _, g := range groups {
+		r.WriteString(g.Driver.Name + " from " + g.Driver.Address)
+		if g.Driver.Time != "" {
+			r.WriteString(" at " + g.Driver.Time)
+		}
+		if len(g.Passengers) == 0 {
+			r.WriteString(" has room for " + strconv.Itoa(g.Driver.Seats) + "\n")
+			continue
+		}
+		var names []string
+		for _, p := range g.Passengers {
+			names = append(names, p.Name)
+		}
+		r.WriteString(" is taking " + strings.Join(names, ", ") + "\n")
+	}
+	for _, p := range left {
+		r.WriteString(p.Name + " from " + p.addressOrUnknown() + " still needs a ride\n")
+	}
+	return r.String(), nil
+}
+
+func (s *server) matchCarpools(day time.Time) ([]carpoolGroup, []passenger, error) {
+	drivers, err := s.carpools.Drivers(day)
+	if err != nil {
+		return nil, nil, err
+	}
+	passengers, err := s.carpools.Passengers(day)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups, left := matchCarpools(drivers, passengers, s.config.Carpool.area)
+	return groups, left, nil
+}
+
+// matchCarpools fills each driver's seats with passengers from their suburb
+// first, then their area, then anyone else left over, and returns who didn't fit
+func matchCarpools(drivers []driver, passengers []passenger, area func(string) string) ([]carpoolGroup, []passenger) {
+	groups := make([]carpoolGroup, len(drivers))
+	for i, d := range drivers {
+		groups[i].Driver = d
+	}
+
+	taken := make([]bool, len(passengers))
+	fill := func(near func(a, b string) bool) {
+		for i := range groups {
+			for j, p := range passengers {
+				if taken[j] || len(groups[i].Passengers) >= groups[i].Driver.Seats {
+					continue
+				}
+				if !near(groups[i].Driver.Address, p.Address) {
+					continue
+				}
+				taken[j] = true
+				groups[i].Passengers = append(groups[i].Passengers, p)
+			}
+		}
+	}
+	fill(sameSuburb)
+	fill(func(a, b string) bool { return area(a) != "" && area(a) == area(b) })
+	fill(func(a, b string) bool { return true })
+
+	var left []passenger
+	for j, p := range passengers {
+		if !taken[j] {
+			left = append(left, p)
+		}
+	}
+	return groups, left
+}
+
+func sameSuburb(a, b string) bool {
+	return a != "" && normSuburb(a) == normSuburb(b)
+}
+
+func normSuburb(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.Replace(s, "mount ", "mt ", 1)
+	return strings.Replace(s, "mt. ", "mt ", 1)
+}
+
+func (p passenger) addressOrUnknown() string {
+	if p.Address == "" {
+		return "somewhere"
+	}
+	return p.Address
+}
+
+// carpoolDetails - what we understood from a carpool command
+type carpoolDetails struct {
+	seats  int
+	suburb string
+	at     string
+	day    time.Time
+}
+
+// parseCarpool picks the seats, suburb, time and day out of eg.
+// "3 seats from ponsonby 8am on friday", the day defaults to tomorrow
+func parseCarpool(words []string, now time.Time) (carpoolDetails, error) {
+	nz := loadLocation("Pacific/Auckland")
+	now = now.In(nz)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, nz)
+	d := carpoolDetails{day: today.AddDate(0, 0, 1)}
+
+	var suburb []string
+	inSuburb := false
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if day, ok := parseCarpoolDay(w, today); ok {
+			d.day = day
+			inSuburb = false
+			continue
+		}
+		if m := carpoolTime.FindStringSubmatch(w); m != nil && (m[2] != "" || m[3] != "") {
+			d.at = w
+			inSuburb = false
+			continue
+		}
+
+		switch {
+		case w == "from":
+			inSuburb = true
+		case w == "on" || w == "at":
+			inSuburb = false
+		case inSuburb:
+			suburb = append(suburb, w)
+		case carpoolSeats.MatchString(w) && i+1 < len(words) && strings.HasPrefix(words[i+1], "seat"):
+			d.seats, _ = strconv.Atoi(w)
+			i++
+		case strings.HasPrefix(w, "20") && strings.Count(w, "-") == 2:
+			return d, errors.Errorf("I couldn't understand the date %s, try YYYY-MM-DD", w)
+		}
+	}
+	d.suburb = titleCase(strings.Join(suburb, " "))
+
+	if d.day.Before(today) {
+		return d, errors.Errorf("%s has already been", d.dayName())
+	}
+	return d, nil
+}
+
+// titleCase capitalises each word, eg. mt eden is Mt Eden
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// parseCarpoolDay understands today, tomorrow, weekdays and YYYY-MM-DD
+func parseCarpoolDay(w string, today time.Time) (time.Time, bool) {
+	switch w {
+	case "today", "tonight":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	}
+	for i := 0; i < 7; i++ {
+		day := today.AddDate(0, 0, i+1)
+		name := strings.ToLower(day.Weekday().String())
+		if w == name || w == name[:3] {
+			return day, true
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", w, today.Location()); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func (d carpoolDetails) date() string {
+	return d.day.Format("2006-01-02")
+}
+
+func (d carpoolDetails) dayName() string {
+	return d.day.Format("Mon 2 Jan")
+}
+
+func (d carpoolDetails) atSuffix() string {
+	if d.at == "" {
+		return ""
+	}
+	return " at " + d.at
+}
+
+func plural(n int, s string) string {
+	if n == 1 {
+		return s
+	}
+	return s + "s"
+}
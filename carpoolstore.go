@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+const (
+	carpoolsKey     = "carpools"
+	carpoolHomesKey = "carpool_homes"
+	carpoolPostsKey = "carpool_posts"
+
+	driveReaction = "car"
+	rideReaction  = "raising_hand"
+
+	defaultCarpoolSeats = 3
+)
+
+// storeCarpool - carpools kept in rudolph's own store, for when there is no carpool service
+type storeCarpool struct {
+	store *store
+}
+
+// carpoolDay - everyone driving or needing a ride on a day
+type carpoolDay struct {
+	Drivers    []driver    `json:"drivers"`
+	Passengers []passenger `json:"passengers"`
+}
+
+// carpoolHome - where someone lives, so reacting to a sign-up is enough
+type carpoolHome struct {
+	Suburb string `json:"suburb"`
+	Seats  int    `json:"seats,omitempty"`
+}
+
+// carpoolPost - a sign-up post, keyed by its timestamp
+type carpoolPost struct {
+	Channel string `json:"channel"`
+	Date    string `json:"date"`
+}
+
+func (c *storeCarpool) Passengers(day time.Time) ([]passenger, error) {
+	days := make(map[string]*carpoolDay)
+	err := c.store.load(carpoolsKey, &days)
+	if err != nil || days[day.Format("2006-01-02")] == nil {
+		return nil, err
+	}
+	return days[day.Format("2006-01-02")].Passengers, nil
+}
+
+func (c *storeCarpool) Drivers(day time.Time) ([]driver, error) {
+	days := make(map[string]*carpoolDay)
+	err := c.store.load(carpoolsKey, &days)
+	if err != nil || days[day.Format("2006-01-02")] == nil {
+		return nil, err
+	}
+	return days[day.Format("2006-01-02")].Drivers, nil
+}
+
+func (c *storeCarpool) AddPassenger(p passenger) error {
+	return c.change(p.Date, func(d *carpoolDay) {
+		d.remove(p.User)
+		d.Passengers = append(d.Passengers, p)
+	})
+}
+
+func (c *storeCarpool) AddDriver(dr driver) error {
+	return c.change(dr.Date, func(d *carpoolDay) {
+		d.remove(dr.User)
+		d.Drivers = append(d.Drivers, dr)
+	})
+}
+
+func (c *storeCarpool) Remove(user string, day time.Time) error {
+	return c.change(day.Format("2006-01-02"), func(d *carpoolDay) {
+		d.remove(user)
+	})
+}
+
+// change updates a day's carpools, and forgets about days more than a week before it
+func (c *storeCarpool) change(date string, f func(d *carpoolDay)) error {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return errors.Wrapf(err, "Could not parse carpool date: %s", date)
+	}
+	days := make(map[string]*carpoolDay)
+	return c.store.update(carpoolsKey, &days, func() error {
+		weekBefore := day.AddDate(0, 0, -7).Format("2006-01-02")
+		for k := range days {
+			if k < weekBefore {
+				delete(days, k)
+			}
+		}
+		if days[date] == nil {
+			days[date] = &carpoolDay{}
+		}
+		f(days[date])
+		return nil
+	})
+}
+
+func (d *carpoolDay) remove(user string) {
+	var drivers []driver
+	for _, dr := range d.Drivers {
+		if dr.User != user {
+			drivers = append(drivers, dr)
+		}
+	}
+	var passengers []passenger
+	for _, p := range d.Passengers {
+		if p.User != user {
+			passengers = append(passengers, p)
+		}
+	}
+	d.Drivers, d.Passengers = drivers, passengers
+}
+
+func (s *server) carpoolHome(user string) carpoolHome {
+	homes := make(map[string]*carpoolHome)
+	if err := s.store.load(carpoolHomesKey, &homes); err != nil {
+		fmt.Printf("Error: %s\n", err)
+	}
+	if h, ok := homes[user]; ok {
+		return *h
+	}
+	return carpoolHome{}
+}
+
+// setCarpoolHome remembers the suburb and seats someone last told us
+func (s *server) setCarpoolHome(user string, d carpoolDetails) error {
+	homes := make(map[string]*carpoolHome)
+	return s.store.update(carpoolHomesKey, &homes, func() error {
+		h, ok := homes[user]
+		if !ok {
+			h = &carpoolHome{}
+			homes[user] = h
+		}
+		if d.suburb != "" {
+			h.Suburb = d.suburb
+		}
+		if d.seats > 0 {
+			h.Seats = d.seats
+		}
+		return nil
+	})
+}
+
+// postCarpoolSignup asks who's carpooling tomorrow, if tomorrow is a work day
+func (s *server) postCarpoolSignup(now time.Time) error {
+	tomorrow := carpoolTomorrow(now)
+	if tomorrow.Weekday() == time.Saturday || tomorrow.Weekday() == time.Sunday {
+		return nil
+	}
+
+	channel := s.config.Carpool.channel()
+	text := fmt.Sprintf("Who's carpooling tomorrow (%s)? React with :%s: if you can drive or :%s: if you need a ride",
+		tomorrow.Format("Mon 2 Jan"), driveReaction, rideReaction)
+	_, ts, err := s.slack.PostMessage(channel, text, slack.PostMessageParameters{AsUser: true})
+	if err != nil {
+		return errors.Wrap(err, "Could not post carpool sign-up")
+	}
+	for _, r := range []string{driveReaction, rideReaction} {
+		err = s.slack.AddReaction(r, slack.NewRefToMessage(channel, ts))
+		if err != nil {
+			return errors.Wrapf(err, "Could not add %s to carpool sign-up", r)
+		}
+	}
+
+	posts := make(map[string]*carpoolPost)
+	return s.store.update(carpoolPostsKey, &posts, func() error {
+		for k, p := range posts {
+			if p.Date < now.AddDate(0, 0, -7).Format("2006-01-02") {
+				delete(posts, k)
+			}
+		}
+		posts[ts] = &carpoolPost{Channel: channel, Date: tomorrow.Format("2006-01-02")}
+		return nil
+	})
+}
+
+// carpoolSignup signs people up from their reactions on a sign-up post,
+// using the suburb and seats they told us last time
+func (s *server) carpoolSignup(user, reaction, ts string, added bool) error {
+	if reaction != driveReaction && reaction != rideReaction {
+		return nil
+	}
+	posts := make(map[string]*carpoolPost)
+	err := s.store.load(carpoolPostsKey, &posts)
+	if err != nil {
+		return err
+	}
+	post, ok := posts[ts]
+	if !ok {
+		return nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", post.Date, loadLocation("Pacific/Auckland"))
+	if err != nil {
+		return errors.Wrapf(err, "Could not parse carpool date: %s", post.Date)
+	}
+
+	if !added {
+		// only take them off if they are still down for what they un-reacted
+		if reaction == driveReaction {
+			drivers, err := s.carpools.Drivers(day)
+			if err != nil || !hasDriver(drivers, user) {
+				return err
+			}
+		} else {
+			passengers, err := s.carpools.Passengers(day)
+			if err != nil || !hasPassenger(passengers, user) {
+				return err
+			}
+		}
+		return s.carpools.Remove(user, day)
+	}
+
+	home := s.carpoolHome(user)
+	if home.Suburb == "" {
+		s.sendDM(user, "I don't know where you live, tell me with @rudolph carpool home <suburb> so I can find you a carpool")
+	}
+	if reaction == driveReaction {
+		seats := home.Seats
+		if seats == 0 {
+			seats = defaultCarpoolSeats
+		}
+		return s.carpools.AddDriver(driver{Name: "<@" + user + ">", User: user, Address: home.Suburb, Date: post.Date, Seats: seats})
+	}
+	return s.carpools.AddPassenger(passenger{Name: "<@" + user + ">", User: user, Address: home.Suburb, Date: post.Date})
+}
+
+// sendCarpoolMatches tells each driver who they are picking up tomorrow, and
+// posts the carpools in the sign-up channel
+func (s *server) sendCarpoolMatches(now time.Time) error {
+	tomorrow := carpoolTomorrow(now)
+	posts := make(map[string]*carpoolPost)
+	err := s.store.load(carpoolPostsKey, &posts)
+	if err != nil {
+		return err
+	}
+	var post *carpoolPost
+	for _, p := range posts {
+		if p.Date == tomorrow.Format("2006-01-02") {
+			post = p
+		}
+	}
+	if post == nil {
+		return nil
+	}
+
+	groups, _, err := s.matchCarpools(tomorrow)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if g.Driver.User == "" || len(g.Passengers) == 0 {
+			continue
+		}
+		var names []string
+		for _, p := range g.Passengers {
+			names = append(names, p.Name+" from "+p.addressOrUnknown())
+		}
+		s.sendDM(g.Driver.User, "You're picking up "+strings.Join(names, ", ")+" tomorrow, thanks for driving :)")
+	}
+
+	resp, err := s.carpoolMatches(tomorrow)
+	if err != nil {
+		return err
+	}
+	s.slack.SendMessage(s.slack.NewOutgoingMessage(resp, post.Channel))
+	return nil
+}
+
+func (s *server) sendDM(user, text string) {
+	_, _, c, err := s.slack.OpenIMChannel(user)
+	if err != nil {
+		fmt.Printf("Error: Could not open an IM channel to: %s: %s\n", user, err)
+		return
+	}
+	s.slack.SendMessage(s.slack.NewOutgoingMessage(text, c))
+}
+
+func carpoolTomorrow(now time.Time) time.Time {
+	nz := loadLocation("Pacific/Auckland")
+	now = now.In(nz)
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, nz)
+}
+
+func hasDriver(drivers []driver, user string) bool {
+	for _, d := range drivers {
+		if d.User == user {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPassenger(passengers []passenger, user string) bool {
+	for _, p := range passengers {
+		if p.User == user {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+const (
+	chartWidth   = 600
+	chartHeight  = 300
+	chartPadding = 20
+)
+
+var (
+	chartBackground = color.RGBA{255, 255, 255, 255}
+	chartGrid       = color.RGBA{230, 230, 230, 255}
+	chartUp         = color.RGBA{46, 160, 67, 255}
+	chartDown       = color.RGBA{215, 58, 73, 255}
+)
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// chart handles eg. chart atm nzx 1m, it uploads a png of the price and
+// falls back to a sparkline when it can't upload files
+func (s *server) chart(channel, text string) (string, error) {
+	words := strings.Fields(strings.TrimPrefix(text, "chart"))
+	period := "1m"
+	if len(words) > 1 {
+		if _, ok := chartPeriods[words[len(words)-1]]; ok {
+			period = words[len(words)-1]
+			words = words[:len(words)-1]
+		}
+	}
+	if len(words) == 0 {
+		return "Tell me what to chart, eg. chart atm nzx 1m", nil
+	}
+	symbol := strings.Join(words, " ")
+
+	points, err := s.quotes.History(symbol, period)
+	if isSymbolNotFound(err) {
+		return "I couldn't find a share called " + symbol + ", try something like chart atm nzx 1m", nil
+	}
+	if isBadSymbol(err) {
+		return err.Error() + ", try something like chart atm nzx 1m", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(points) < 2 {
+		return "I don't have enough prices to chart " + symbol + " over " + period, nil
+	}
+
+	summary := chartSummary(symbol, period, points)
+	img, err := renderChart(points, chartWidth, chartHeight)
+	if err != nil {
+		return "", err
+	}
+	_, err = s.slack.UploadFile(slack.FileUploadParameters{
+		Reader:         bytes.NewReader(img),
+		Filetype:       "png",
+		Filename:       strings.Replace(symbol, " ", "-", -1) + "-" + period + ".png",
+		Title:          summary,
+		InitialComment: summary,
+		Channels:       []string{channel},
+	})
+	if err != nil {
+		fmt.Printf("Error: Could not upload chart, sending a sparkline instead: %s\n", err)
+		return summary + "\n" + sparkline(points), nil
+	}
+	return "", nil
+}
+
+// chartSummary is eg. atm nzx over 1m: $3.90 to $4.20 (+7.69%)
+func chartSummary(symbol, period string, points []pricePoint) string {
+	first, last := points[0].Price, points[len(points)-1].Price
+	return fmt.Sprintf("%s over %s: $%.2f to $%.2f (%+.2f%%)", symbol, period, first, last, (last-first)/first*100)
+}
+
+// sparkline squashes the prices into a line of block characters
+func sparkline(points []pricePoint) string {
+	lo, hi := priceRange(points)
+	var b strings.Builder
+	for _, p := range points {
+		i := 0
+		if hi > lo {
+			i = int(math.Round((p.Price - lo) / (hi - lo) * float64(len(sparks)-1)))
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
+
+// renderChart draws the prices as a line, green if they went up and red if
+// they went down, over a few grid lines
+func renderChart(points []pricePoint, width, height int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, chartBackground)
+		}
+	}
+
+	inner := image.Rect(chartPadding, chartPadding, width-chartPadding, height-chartPadding)
+	for i := 0; i <= 4; i++ {
+		y := inner.Min.Y + i*inner.Dy()/4
+		drawLine(img, inner.Min.X, y, inner.Max.X, y, chartGrid)
+	}
+
+	lo, hi := priceRange(points)
+	if hi == lo {
+		hi, lo = hi+1, lo-1
+	}
+	start, end := points[0].Time, points[len(points)-1].Time
+	span := end.Sub(start).Seconds()
+
+	line := chartUp
+	if points[len(points)-1].Price < points[0].Price {
+		line = chartDown
+	}
+
+	px := func(p pricePoint) (int, int) {
+		x := inner.Min.X
+		if span > 0 {
+			x += int(p.Time.Sub(start).Seconds() / span * float64(inner.Dx()))
+		}
+		y := inner.Max.Y - int((p.Price-lo)/(hi-lo)*float64(inner.Dy()))
+		return x, y
+	}
+	for i := 1; i < len(points); i++ {
+		x0, y0 := px(points[i-1])
+		x1, y1 := px(points[i])
+		// two pixels thick so it shows up in slack's preview
+		drawLine(img, x0, y0, x1, y1, line)
+		drawLine(img, x0, y0+1, x1, y1+1, line)
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not encode chart")
+	}
+	return buf.Bytes(), nil
+}
+
+// drawLine is bresenham's line algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if 2*e >= dy {
+			e += dy
+			x0 += sx
+		}
+		if 2*e <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func priceRange(points []pricePoint) (float64, float64) {
+	lo, hi := points[0].Price, points[0].Price
+	for _, p := range points {
+		lo = math.Min(lo, p.Price)
+		hi = math.Max(hi, p.Price)
+	}
+	return lo, hi
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
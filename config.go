@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// config - everything that isn't a secret, secrets stay in the environment
+type config struct {
+	Backlog backlogConfig `json:"backlog"`
+	Meetups meetupsConfig `json:"meetups"`
+	Carpool carpoolConfig `json:"carpool"`
+	Shares  sharesConfig  `json:"shares"`
+	HWR     hwrConfig     `json:"hwr"`
+	WakeUp  wakeUpConfig  `json:"wake_up"`
+	DMs     dmsConfig     `json:"dms"`
+}
+
+type backlogConfig struct {
+	// Backend is one of trello (the default), file or github
+	Backend string `json:"backend"`
+	File    string `json:"file"`
+	Repo    string `json:"repo"`
+
+	token string
+}
+
+// meetupsConfig - the meetup groups and ics feeds we recommend events from
+type meetupsConfig struct {
+	Groups  []string `json:"groups"`
+	Feeds   []string `json:"feeds"`
+	Channel string   `json:"channel"`
+}
+
+func (m meetupsConfig) channel() string {
+	if m.Channel == "" {
+		return teamChannelID
+	}
+	return m.Channel
+}
+
+// carpoolConfig - without a URL for the carpool service rudolph runs
+// carpools itself and posts sign-ups in Channel. Areas groups suburbs that
+// are close enough to share a ride, eg. {"west": ["Henderson", "Te Atatu"]}
+type carpoolConfig struct {
+	URL     string              `json:"url"`
+	Channel string              `json:"channel"`
+	Areas   map[string][]string `json:"areas"`
+}
+
+func (c carpoolConfig) local() bool {
+	return c.URL == ""
+}
+
+func (c carpoolConfig) channel() string {
+	if c.Channel == "" {
+		return teamChannelID
+	}
+	return c.Channel
+}
+
+// area is the area a suburb is in, or "" if it isn't in one
+func (c carpoolConfig) area(suburb string) string {
+	for a, suburbs := range c.Areas {
+		for _, s := range suburbs {
+			if sameSuburb(s, suburb) {
+				return a
+			}
+		}
+	}
+	return ""
+}
+
+// sharesConfig - where share prices come from, Provider is yahoo (the
+// default) or fixture, which reads quotes from the Fixtures file
+type sharesConfig struct {
+	Provider string `json:"provider"`
+	Fixtures string `json:"fixtures"`
+}
+
+// hwrConfig - the behaviours people can be recognised for, the defaults
+// are used when there aren't any. Managers are the slack user ids that can
+// export anyone's recognitions
+type hwrConfig struct {
+	Behaviours []behaviour `json:"behaviours"`
+	Managers   []string    `json:"managers"`
+}
+
+func (h hwrConfig) isManager(user string) bool {
+	for _, m := range h.Managers {
+		if strings.EqualFold(m, user) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h hwrConfig) behaviours() []behaviour {
+	if len(h.Behaviours) == 0 {
+		return defaultBehaviours
+	}
+	return h.Behaviours
+}
+
+func (h hwrConfig) behaviour(code string) (behaviour, bool) {
+	for _, b := range h.behaviours() {
+		if strings.EqualFold(b.Code, code) {
+			return b, true
+		}
+	}
+	return behaviour{}, false
+}
+
+// emojiBehaviour is the behaviour a reaction recognises, if any
+func (h hwrConfig) emojiBehaviour(emoji string) (behaviour, bool) {
+	for _, b := range h.behaviours() {
+		if b.Emoji != "" && b.Emoji == emoji {
+			return b, true
+		}
+	}
+	return behaviour{}, false
+}
+
+func (h hwrConfig) validate() error {
+	codes := make(map[string]bool)
+	emojis := make(map[string]bool)
+	for _, b := range h.Behaviours {
+		code := strings.ToLower(b.Code)
+		if code == "" || b.Name == "" {
+			return errors.Errorf("HWR behaviours need a code and a name: %+v", b)
+		}
+		if strings.ContainsAny(code, " <>") {
+			return errors.Errorf("HWR behaviour code can't have spaces or <>: %s", b.Code)
+		}
+		if codes[code] {
+			return errors.Errorf("HWR behaviour code used twice: %s", b.Code)
+		}
+		codes[code] = true
+		if b.Emoji != "" {
+			if emojis[b.Emoji] {
+				return errors.Errorf("HWR behaviour emoji used twice: %s", b.Emoji)
+			}
+			emojis[b.Emoji] = true
+		}
+	}
+	return nil
+}
+
+func loadConfig(path string) (config, error) {
+	var c config
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, errors.Wrapf(err, "Could not read config: %s", path)
+	}
+
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return c, errors.Wrapf(err, "Could not deserialise config: %s", path)
+	}
+	return c, errors.Wrapf(c.HWR.validate(), "Invalid config: %s", path)
+}
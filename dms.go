@@ -0,0 +1,197 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dmOptOutsKey = "dm_opt_outs"
+	dmAuditKey   = "dm_audit"
+
+	defaultSenderDMsPerHour = 10
+	defaultTargetDMsPerHour = 5
+
+	// how long we keep the audit log for
+	dmAuditDays = 30
+)
+
+// dmsConfig - how many DMs someone can get rudolph to send in an hour, and
+// how many DMs someone can be sent in an hour
+type dmsConfig struct {
+	SenderPerHour int `json:"sender_per_hour"`
+	TargetPerHour int `json:"target_per_hour"`
+}
+
+func (d dmsConfig) senderPerHour() int {
+	if d.SenderPerHour <= 0 {
+		return defaultSenderDMsPerHour
+	}
+	return d.SenderPerHour
+}
+
+func (d dmsConfig) targetPerHour() int {
+	if d.TargetPerHour <= 0 {
+		return defaultTargetDMsPerHour
+	}
+	return d.TargetPerHour
+}
+
+// dmAudit - someone getting rudolph to DM someone else
+type dmAudit struct {
+	Time    time.Time `json:"time"`
+	Sender  string    `json:"sender"`
+	Target  string    `json:"target"`
+	Command string    `json:"command"`
+}
+
+// guardDMs wraps commands that DM other people. It turns away anyone who
+// has opted out or had too many DMs, and anyone who has sent too many, and
+// keeps an audit log of who got rudolph to DM who. run returns who it
+// actually DMed, only they are counted
+func (s *server) guardDMs(sender, command string, targets []string, now time.Time, run func() (string, []string, error)) (string, error) {
+	others := otherUsers(sender, targets)
+	if len(others) == 0 {
+		resp, _, err := run()
+		return resp, err
+	}
+
+	limits, err := s.loadDMLimits(now)
+	if err != nil {
+		return "", err
+	}
+	if refusal := limits.refuse(sender, others, s.config.DMs); refusal != "" {
+		return refusal, nil
+	}
+
+	resp, dmed, err := run()
+	// whatever went wrong, anyone who got a DM still counts
+	if auditErr := s.auditDMs(sender, command, otherUsers(sender, dmed), now); auditErr != nil && err == nil {
+		err = auditErr
+	}
+	return resp, err
+}
+
+// otherUsers is everyone in users except sender, once each
+func otherUsers(sender string, users []string) []string {
+	var others []string
+	for _, u := range users {
+		if u != "" && u != sender && !contains(others, u) {
+			others = append(others, u)
+		}
+	}
+	return others
+}
+
+// dmLimits - who has opted out of DMs, and how many DMs people have sent
+// and been sent in the last hour
+type dmLimits struct {
+	optOuts  map[string]bool
+	sent     map[string]int
+	received map[string]int
+}
+
+func (s *server) loadDMLimits(now time.Time) (*dmLimits, error) {
+	l := &dmLimits{optOuts: make(map[string]bool), sent: make(map[string]int), received: make(map[string]int)}
+	err := s.store.load(dmOptOutsKey, &l.optOuts)
+	if err != nil {
+		return nil, err
+	}
+
+	var audit []dmAudit
+	err = s.store.load(dmAuditKey, &audit)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range audit {
+		if a.Time.After(now.Add(-time.Hour)) && !a.Time.After(now) {
+			l.record(a.Sender, []string{a.Target})
+		}
+	}
+	return l, nil
+}
+
+// refuse is why sender can't DM targets right now, or "" if they can
+func (l *dmLimits) refuse(sender string, targets []string, cfg dmsConfig) string {
+	for _, t := range targets {
+		if l.optOuts[t] {
+			return "Sorry, <@" + t + "> has asked me not to DM them"
+		}
+	}
+	if l.sent[sender]+len(targets) > cfg.senderPerHour() {
+		return "Easy tiger, you've had me send " + strconv.Itoa(l.sent[sender]) + " DMs in the last hour, try again later"
+	}
+	for _, t := range targets {
+		if l.received[t] >= cfg.targetPerHour() {
+			return "<@" + t + "> has had enough DMs from me for now, try again later"
+		}
+	}
+	return ""
+}
+
+func (l *dmLimits) record(sender string, targets []string) {
+	l.sent[sender] += len(targets)
+	for _, t := range targets {
+		l.received[t]++
+	}
+}
+
+// auditDMs logs sender getting rudolph to DM targets, and forgets about
+// anything older than dmAuditDays
+func (s *server) auditDMs(sender, command string, targets []string, now time.Time) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	var audit []dmAudit
+	return s.store.update(dmAuditKey, &audit, func() error {
+		var kept []dmAudit
+		for _, a := range audit {
+			if a.Time.After(now.AddDate(0, 0, -dmAuditDays)) {
+				kept = append(kept, a)
+			}
+		}
+		for _, t := range targets {
+			kept = append(kept, dmAudit{Time: now, Sender: sender, Target: t, Command: command})
+		}
+		audit = kept
+		return nil
+	})
+}
+
+// optOutOfDMs handles stop pinging me and start pinging me
+func (s *server) optOutOfDMs(user, text string) (string, error) {
+	stop := strings.HasPrefix(text, "stop")
+	optOuts := make(map[string]bool)
+	err := s.store.update(dmOptOutsKey, &optOuts, func() error {
+		if stop {
+			optOuts[user] = true
+		} else {
+			delete(optOuts, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if stop {
+		return "Okay, I won't DM you when people ask me to. Say start pinging me if you change your mind", nil
+	}
+	return "Okay, people can get me to DM you again", nil
+}
+
+// parseMentions takes the <@U123> mentions off the front of words, and
+// returns their user ids and the rest of the words
+func parseMentions(words []string) ([]string, []string) {
+	var users []string
+	for len(words) > 0 && strings.HasPrefix(words[0], "<@") && strings.HasSuffix(words[0], ">") {
+		user := strings.ToUpper(strings.TrimSuffix(strings.TrimPrefix(words[0], "<@"), ">"))
+		// <@U123|ruskin.dantra>
+		if i := strings.Index(user, "|"); i != -1 {
+			user = user[:i]
+		}
+		users = append(users, user)
+		words = words[1:]
+	}
+	return users, words
+}
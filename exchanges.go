@@ -0,0 +1,178 @@
+package main
+
+import (
+	"time"
+)
+
+// exchange - when an exchange trades, in its own timezone. Open and Close
+// are HH:MM
+type exchange struct {
+	Name     string
+	Location string
+	Open     string
+	Close    string
+	holidays func(year int) []time.Time
+}
+
+var exchanges = map[string]*exchange{
+	"NZX": {Name: "NZX", Location: "Pacific/Auckland", Open: "10:00", Close: "16:45", holidays: nzxHolidays},
+	"ASX": {Name: "ASX", Location: "Australia/Sydney", Open: "10:00", Close: "16:00", holidays: asxHolidays},
+}
+
+// exchangeFor is the exchange a symbol like "atm nzx" trades on, or nil if
+// we don't have a calendar for it
+func exchangeFor(symbol string) *exchange {
+	_, e, err := parseSymbol(symbol)
+	if err != nil {
+		return nil
+	}
+	return exchanges[e]
+}
+
+func (e *exchange) location() *time.Location {
+	return loadLocation(e.Location)
+}
+
+// tradingDay is whether the exchange trades on the day t falls on in its timezone
+func (e *exchange) tradingDay(t time.Time) bool {
+	t = t.In(e.location())
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+	for _, h := range e.holidays(t.Year()) {
+		if h.Month() == t.Month() && h.Day() == t.Day() {
+			return false
+		}
+	}
+	return true
+}
+
+// isOpen is whether the exchange is trading at t
+func (e *exchange) isOpen(t time.Time) bool {
+	hm := t.In(e.location()).Format("15:04")
+	return e.tradingDay(t) && hm >= e.Open && hm < e.Close
+}
+
+// at is whether t is the exchange's open or close, on a trading day
+func (e *exchange) at(t time.Time, openOrClose string) bool {
+	hm := e.Open
+	if openOrClose == "close" {
+		hm = e.Close
+	}
+	return e.tradingDay(t) && t.In(e.location()).Format("15:04") == hm
+}
+
+// matariki moves with the lunar calendar, these are the dates set in the
+// Te Kāhui o Matariki Public Holiday Act 2022
+var matariki = map[int]time.Time{
+	2022: date(2022, time.June, 24),
+	2023: date(2023, time.July, 14),
+	2024: date(2024, time.June, 28),
+	2025: date(2025, time.June, 20),
+	2026: date(2026, time.July, 10),
+	2027: date(2027, time.June, 25),
+	2028: date(2028, time.July, 14),
+	2029: date(2029, time.July, 6),
+	2030: date(2030, time.June, 21),
+	2031: date(2031, time.July, 11),
+	2032: date(2032, time.July, 2),
+	2033: date(2033, time.June, 24),
+	2034: date(2034, time.July, 7),
+	2035: date(2035, time.June, 29),
+}
+
+// nzxHolidays - the NZX closes on the national public holidays, with the
+// ones that fall on a weekend moved to the following Monday (or Tuesday)
+func nzxHolidays(year int) []time.Time {
+	easter := easterSunday(year)
+	h := []time.Time{
+		easter.AddDate(0, 0, -2),
+		easter.AddDate(0, 0, 1),
+		nthWeekday(year, time.June, time.Monday, 1),
+		nthWeekday(year, time.October, time.Monday, 4),
+	}
+	h = append(h, pairHolidays(date(year, time.January, 1))...)
+	h = append(h, pairHolidays(date(year, time.December, 25))...)
+	// waitangi and anzac day were only mondayised from 2014
+	for _, d := range []time.Time{date(year, time.February, 6), date(year, time.April, 25)} {
+		if year >= 2014 {
+			d = mondayise(d)
+		}
+		h = append(h, d)
+	}
+	if m, ok := matariki[year]; ok {
+		h = append(h, m)
+	}
+	return h
+}
+
+// asxHolidays - the ASX follows the New South Wales public holidays, except
+// for bank holiday and labour day when it trades
+func asxHolidays(year int) []time.Time {
+	easter := easterSunday(year)
+	h := []time.Time{
+		easter.AddDate(0, 0, -2),
+		easter.AddDate(0, 0, 1),
+		mondayise(date(year, time.January, 1)),
+		mondayise(date(year, time.January, 26)),
+		// anzac day isn't moved when it is on a weekend
+		date(year, time.April, 25),
+		nthWeekday(year, time.June, time.Monday, 2),
+	}
+	return append(h, pairHolidays(date(year, time.December, 25))...)
+}
+
+// pairHolidays moves two holidays in a row, like christmas and boxing day,
+// off the weekend without landing on the same day
+func pairHolidays(first time.Time) []time.Time {
+	second := first.AddDate(0, 0, 1)
+	switch first.Weekday() {
+	case time.Friday:
+		return []time.Time{first, second.AddDate(0, 0, 2)}
+	case time.Saturday:
+		return []time.Time{first.AddDate(0, 0, 2), second.AddDate(0, 0, 2)}
+	case time.Sunday:
+		return []time.Time{first.AddDate(0, 0, 2), second}
+	}
+	return []time.Time{first, second}
+}
+
+// mondayise moves a holiday on the weekend to the following Monday
+func mondayise(d time.Time) time.Time {
+	switch d.Weekday() {
+	case time.Saturday:
+		return d.AddDate(0, 0, 2)
+	case time.Sunday:
+		return d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+// nthWeekday is eg. the 4th Monday in October
+func nthWeekday(year int, month time.Month, day time.Weekday, n int) time.Time {
+	d := date(year, month, 1)
+	for d.Weekday() != day {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d.AddDate(0, 0, 7*(n-1))
+}
+
+// easterSunday uses the anonymous gregorian algorithm
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return date(year, time.Month(month), day)
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
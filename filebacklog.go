@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fileBacklog - keeps the backlog in a local json file, for teams without trello
+type fileBacklog struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (f *fileBacklog) Items(list string) ([]backlogItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	items, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []backlogItem
+	for _, i := range items {
+		if i.List == list {
+			res = append(res, i)
+		}
+	}
+	return res, nil
+}
+
+func (f *fileBacklog) Create(list string, item *backlogItem) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	items, err := f.load()
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	for _, i := range items {
+		if n, err := strconv.Atoi(i.ID); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	item.ID = strconv.Itoa(next)
+	item.List = list
+
+	return f.save(append(items, *item))
+}
+
+func (f *fileBacklog) Move(id, list string) error {
+	return f.update(id, func(i *backlogItem) { i.List = list })
+}
+
+func (f *fileBacklog) SetDue(id string, due *time.Time) error {
+	return f.update(id, func(i *backlogItem) { i.Due = due })
+}
+
+func (f *fileBacklog) update(id string, change func(i *backlogItem)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	items, err := f.load()
+	if err != nil {
+		return err
+	}
+
+	i, err := findItem(items, id)
+	if err != nil {
+		return err
+	}
+	change(&items[i])
+
+	return f.save(items)
+}
+
+func (f *fileBacklog) load() ([]backlogItem, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not read backlog: %s", f.path)
+	}
+
+	var items []backlogItem
+	err = json.Unmarshal(data, &items)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not deserialise backlog: %s", f.path)
+	}
+	return items, nil
+}
+
+// save writes to a temp file first so a crash can't leave half a backlog behind
+func (f *fileBacklog) save(items []backlogItem) error {
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Could not serialise backlog")
+	}
+
+	tmp := f.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Could not write backlog: %s", tmp)
+	}
+	return os.Rename(tmp, f.path)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// githubBacklog - keeps the backlog as github issues, the list is a label
+// and the due date lives in a comment in the issue body
+type githubBacklog struct {
+	client  *http.Client
+	baseURL string
+	repo    string
+	token   string
+}
+
+type githubLabel struct {
+	Name string `json:"name"`
+}
+
+type githubIssue struct {
+	Number  int           `json:"number"`
+	Title   string        `json:"title"`
+	Body    string        `json:"body"`
+	HTMLURL string        `json:"html_url"`
+	Labels  []githubLabel `json:"labels"`
+}
+
+var dueComment = regexp.MustCompile(`\n?<!-- due: (\S+) -->`)
+
+func newGitHubBacklog(client *http.Client, repo, token string) *githubBacklog {
+	return &githubBacklog{
+		client:  client,
+		baseURL: "https://api.github.com",
+		repo:    repo,
+		token:   token,
+	}
+}
+
+func (g *githubBacklog) Items(list string) ([]backlogItem, error) {
+	var issues []githubIssue
+	path := fmt.Sprintf("/repos/%s/issues?state=open&per_page=100&labels=%s", g.repo, url.QueryEscape(list))
+	err := g.do("GET", path, nil, &issues)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]backlogItem, 0, len(issues))
+	for _, i := range issues {
+		desc, due := splitDue(i.Body)
+		items = append(items, backlogItem{
+			ID:          strconv.Itoa(i.Number),
+			List:        list,
+			Title:       i.Title,
+			Description: desc,
+			URL:         i.HTMLURL,
+			Due:         due,
+		})
+	}
+	return items, nil
+}
+
+func (g *githubBacklog) Create(list string, item *backlogItem) error {
+	in := map[string]interface{}{
+		"title":  item.Title,
+		"body":   joinDue(item.Description, item.Due),
+		"labels": []string{list},
+	}
+
+	var issue githubIssue
+	err := g.do("POST", fmt.Sprintf("/repos/%s/issues", g.repo), in, &issue)
+	if err != nil {
+		return err
+	}
+
+	item.ID = strconv.Itoa(issue.Number)
+	item.List = list
+	item.URL = issue.HTMLURL
+	return nil
+}
+
+// Move swaps the list label, leaving any other labels alone
+func (g *githubBacklog) Move(id, list string) error {
+	issue, err := g.issue(id)
+	if err != nil {
+		return err
+	}
+
+	labels := []string{list}
+	for _, l := range issue.Labels {
+		if l.Name != ideasList && l.Name != scheduledList && l.Name != meetupsList {
+			labels = append(labels, l.Name)
+		}
+	}
+
+	path := fmt.Sprintf("/repos/%s/issues/%s/labels", g.repo, id)
+	return g.do("PUT", path, map[string][]string{"labels": labels}, nil)
+}
+
+func (g *githubBacklog) SetDue(id string, due *time.Time) error {
+	issue, err := g.issue(id)
+	if err != nil {
+		return err
+	}
+
+	desc, _ := splitDue(issue.Body)
+	path := fmt.Sprintf("/repos/%s/issues/%s", g.repo, id)
+	return g.do("PATCH", path, map[string]string{"body": joinDue(desc, due)}, nil)
+}
+
+func (g *githubBacklog) issue(id string) (githubIssue, error) {
+	var issue githubIssue
+	err := g.do("GET", fmt.Sprintf("/repos/%s/issues/%s", g.repo, id), nil, &issue)
+	return issue, err
+}
+
+func (g *githubBacklog) do(method, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return errors.Wrapf(err, "Could not serialise request for %s", path)
+		}
+	}
+
+	req, err := http.NewRequest(method, g.baseURL+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Accept", "application/vnd.github.v3+json")
+	if g.token != "" {
+		req.Header.Add("Authorization", "token "+g.token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Could not make request to %s", path)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return errors.Wrapf(err, "Could not read request for %s", path)
+	}
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("Github returned %d for %s: %s", resp.StatusCode, path, data)
+	}
+
+	if out == nil {
+		return nil
+	}
+	err = json.Unmarshal(data, out)
+	if err != nil {
+		return errors.Wrapf(err, "Could not deserialise request for %s", path)
+	}
+	return nil
+}
+
+func splitDue(body string) (string, *time.Time) {
+	m := dueComment.FindStringSubmatch(body)
+	if m == nil {
+		return body, nil
+	}
+
+	desc := strings.TrimSpace(dueComment.ReplaceAllString(body, ""))
+	d, err := time.Parse(time.RFC3339, m[1])
+	if err != nil {
+		return desc, nil
+	}
+	return desc, &d
+}
+
+func joinDue(desc string, due *time.Time) string {
+	if due == nil {
+		return desc
+	}
+	return desc + "\n<!-- due: " + due.UTC().Format(time.RFC3339) + " -->"
+}
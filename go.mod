@@ -1,15 +1,20 @@
 module github.com/dhruv11/rudolph
 
+go 1.23
+
 require (
 	github.com/adlio/trello v0.0.0-20180621142300-8a458717123e
+	github.com/nlopes/slack v0.3.0
+	github.com/pkg/errors v0.8.0
+	github.com/stretchr/testify v1.2.2
+)
+
+require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/gorilla/websocket v1.4.0 // indirect
 	github.com/lusis/slack-test v0.0.0-20180109053238-3c758769bfa6 // indirect
-	github.com/nlopes/slack v0.3.0
-	github.com/pkg/errors v0.8.0
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.1.1 // indirect
-	github.com/stretchr/testify v1.2.2
 	github.com/vektra/mockery v0.0.0-20180815001236-ea265755d541 // indirect
 	golang.org/x/tools v0.0.0-20180910044924-becf93d7cfc6 // indirect
 )
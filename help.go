@@ -2,13 +2,28 @@ package main
 
 import (
 	"math/rand"
-	"strings"
-
-	"github.com/pkg/errors"
 )
 
 func getHelp() string {
-	helpText := "I can help you with: \n Fetching ideas - @rudolph ideas \n Fetching scheduled talks - @rudolph scheduled \n Adding an idea: @rudolph add <talk title> \n Dad joke - @rudolph make me laugh \n Recognizing a HWR behaviour - @rudolph hwr <user handle> <2 letter behaviour initial> <message> \n\tEg. @rudolph hwr @ruskin.dantra CC It was awesome when you rapped for all of us \n Help - @rudolph help"
+	helpText := "I can help you with: \n Fetching ideas - @rudolph ideas \n Fetching scheduled talks - @rudolph scheduled \n Adding an idea: @rudolph add <talk title> " +
+		"\n Scheduling a talk - @rudolph schedule <talk title> on <yyyy-mm-dd> " +
+		"\n Adding meetups - @rudolph <meetup.com, eventbrite, lu.ma or .ics link>, or share an .ics file with @rudolph " +
+		"\n Who's going to a meetup - @rudolph who's going to <meetup> " +
+		"\n Carpooling - @rudolph carpool offer 3 seats from <suburb> 8am, @rudolph carpool need ride from <suburb> tomorrow, @rudolph carpool home <suburb> " +
+		"\n Share prices - @rudolph price <symbol> <exchange>, @rudolph chart <symbol> <exchange> 1m " +
+		"\n Watching shares - @rudolph watch <symbol> <exchange>, @rudolph my watchlist, @rudolph watchlist times 9:30am 4pm " +
+		"\n Price alerts - @rudolph alert <symbol> <exchange> above 4.50, @rudolph my alerts, @rudolph cancel alert <number> " +
+		"\n Your portfolio - @rudolph portfolio add 100 <symbol> <exchange> @ 3.20, @rudolph portfolio " +
+		"\n Dad joke - @rudolph make me laugh " +
+		"\n Recognizing a HWR behaviour - @rudolph hwr <user handles> <2 letter behaviour initial> <message> " +
+		"\n\tEg. @rudolph hwr @ruskin.dantra CC It was awesome when you rapped for all of us " +
+		"\n\tAlso @rudolph hwr behaviours, hwr stats, hwr leaderboard and hwr export <user handle> since <yyyy-mm-dd> " +
+		"\n Waking someone up - @rudolph wake up <user handle> <why>, @rudolph snooze 30m, @rudolph unsnooze " +
+		"\n Not being DMed when people ask - @rudolph stop pinging me, @rudolph start pinging me " +
+		"\n Picking someone - @rudolph who's buying coffee, @rudolph who of <user handles> " +
+		"\n Taking turns - @rudolph rotation create <name> <user handles> weekly, @rudolph rotation next <name>, @rudolph rotations " +
+		"\n Async standups - @rudolph standup at 9:30am, @rudolph standup questions <question> | <question>, @rudolph standup now " +
+		"\n Help - @rudolph help"
 	return helpText
 }
 
@@ -26,64 +41,3 @@ func getContribute() string {
 	contributeText := "Sorry buddy, I don't know how to do that yet, why don't you contribute to my code base? \nhttps://github.com/dhruv11/rudolph\n"
 	return contributeText + getHelp()
 }
-
-func wakeUp(user string, slack SlackRTMInterface) (string, error) {
-	user = strings.TrimPrefix(user, "wake up <@")
-	user = strings.TrimSuffix(user, ">")
-	user = strings.ToUpper(user)
-
-	_, _, c, err := slack.OpenIMChannel(user)
-	if err != nil {
-		return "", errors.Wrapf(err, "Could not open an IM channel to: %s", user)
-	}
-	slack.SendMessage(slack.NewOutgoingMessage("buddy stop napping at work, people are looking for you...", c))
-
-	u, err := slack.GetUserInfo(user)
-	if err != nil {
-		return "I've just pinged them for you :)", nil
-	}
-	return "I've just pinged " + u.RealName + " for you :)", nil
-}
-
-func hwr(text string, slack SlackRTMInterface) (string, error) {
-	text = strings.TrimPrefix(text, "hwr <@")
-	nameEnd := strings.Index(text, ">")
-	name := text[0:nameEnd]
-	name = strings.ToUpper(name)
-	behaviours := map[string]string{
-		"rr": "recognized reveller",
-		"dd": "dedicated discoverer",
-		"cc": "crystal clear carer",
-		"pp": "punter passion",
-		"ge": "gutsy evolver",
-		"ra": "rapid adapter",
-	}
-	b := text[nameEnd+2 : nameEnd+4]
-	m := text[nameEnd+5:]
-
-	_, _, c, err := slack.OpenIMChannel(name)
-	if err != nil {
-		return "", errors.Wrapf(err, "Could not open an IM channel to: %s", name)
-	}
-	slack.SendMessage(slack.NewOutgoingMessage("Wohoo! Someone just nominated you for being a "+behaviours[b]+"!\n They said \""+m+"\"", c))
-
-	u, err := slack.GetUserInfo(name)
-	if err != nil {
-		return "I've passed on your feedback anonymously! \n Good on you for being a Recognized Reveller :)", nil
-	}
-	return "I've passed on your feedback to " + u.RealName + " anonymously! \n Good on you for being a Recognized Reveller :)", nil
-}
-
-func getRandomUserFromChannel(channel string, slack SlackRTMInterface) (string, error) {
-	c, err := slack.GetChannelInfo(channel)
-	if err != nil {
-		return "", errors.Wrapf(err, "Could not retrieve channel info for: %s", channel)
-	}
-	i := rand.Intn(len(c.Members))
-
-	u, err := slack.GetUserInfo(c.Members[i])
-	if err != nil {
-		return "", err
-	}
-	return u.RealName, nil
-}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const nominationsKey = "nominations"
+
+// behaviour - something people can be recognised for, Emoji is the name
+// of a slack emoji without the colons. Reacting with it nominates someone,
+// so the defaults leave it empty and teams opt in through the config
+type behaviour struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Emoji       string `json:"emoji"`
+	Description string `json:"description"`
+}
+
+var defaultBehaviours = []behaviour{
+	{Code: "rr", Name: "recognized reveller", Description: "celebrates the wins, big and small"},
+	{Code: "dd", Name: "dedicated discoverer", Description: "digs in until they get to the bottom of it"},
+	{Code: "cc", Name: "crystal clear carer", Description: "says what they mean and looks out for people"},
+	{Code: "pp", Name: "punter passion", Description: "puts our customers first"},
+	{Code: "ge", Name: "gutsy evolver", Description: "tries the bold thing and learns from it"},
+	{Code: "ra", Name: "rapid adapter", Description: "rolls with the changes"},
+}
+
+// nomination - someone being recognised for a HWR behaviour. Nominator is
+// only kept so we can stop abuse, we promise it is never shown to anyone
+type nomination struct {
+	Nominee   string    `json:"nominee"`
+	Behaviour string    `json:"behaviour"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+	Nominator string    `json:"nominator"`
+	// Link is the message they were recognised for, when it came from a reaction
+	Link string `json:"link,omitempty"`
+}
+
+// hwr handles eg.
+//
+//	hwr <@U123> cc It was awesome when you rapped for all of us
+//	hwr <@U123> <@U456> ge Thanks for shipping it
+//	hwr behaviours
+//	hwr stats
+//	hwr leaderboard
+//	hwr export <@U123> since 2018-04-01
+//
+// It also returns who it DMed, so they count towards the DM limits
+func (s *server) hwr(user, text string, now time.Time) (string, []string, error) {
+	text = strings.TrimSpace(text[len("hwr"):])
+	switch strings.ToLower(text) {
+	case "behaviours", "behaviors":
+		return s.hwrBehaviours(), nil, nil
+	case "stats":
+		resp, err := s.hwrStats()
+		return resp, nil, err
+	case "export":
+		return "Tell me whose recognitions to export, eg. hwr export @ruskin.dantra since 2018-04-01", nil, nil
+	case "leaderboard":
+		resp, err := s.hwrLeaderboard(now)
+		return resp, nil, err
+	}
+
+	words := strings.Fields(text)
+	if len(words) > 1 && strings.ToLower(words[0]) == "export" {
+		resp, err := s.hwrExport(user, words[1:], now)
+		return resp, nil, err
+	}
+	nominees, words := parseMentions(words)
+	if len(nominees) == 0 {
+		return "Tell me who and what for, eg. hwr @ruskin.dantra CC It was awesome when you rapped for all of us", nil, nil
+	}
+	if len(words) == 0 {
+		return "Tell me which behaviour, one of " + s.behaviourCodes(), nil, nil
+	}
+	b, ok := s.config.HWR.behaviour(words[0])
+	if !ok {
+		return "I don't know the behaviour " + words[0] + ", try one of " + s.behaviourCodes(), nil, nil
+	}
+
+	// make sure we can reach everyone before nominating anyone
+	ims := make(map[string]string)
+	var unreachable []string
+	for _, nominee := range nominees {
+		_, _, c, err := s.slack.OpenIMChannel(nominee)
+		if err != nil {
+			fmt.Printf("Error: Could not open an IM channel to: %s: %s\n", nominee, err)
+			unreachable = append(unreachable, "<@"+nominee+">")
+			continue
+		}
+		ims[nominee] = c
+	}
+	if len(unreachable) > 0 {
+		return "I couldn't get through to " + joinNames(unreachable) + " so I haven't passed on your feedback to anyone, try again in a bit", nil, nil
+	}
+
+	var names, dmed []string
+	for _, nominee := range nominees {
+		name, err := s.nominate(nomination{Nominee: nominee, Behaviour: b.Code, Message: strings.Join(words[1:], " "), Time: now, Nominator: user}, ims[nominee])
+		if err != nil {
+			return "", dmed, err
+		}
+		dmed = append(dmed, nominee)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) < len(nominees) {
+		return "I've passed on your feedback anonymously! \n Good on you for being a Recognized Reveller :)", dmed, nil
+	}
+	return "I've passed on your feedback to " + joinNames(names) + " anonymously! \n Good on you for being a Recognized Reveller :)", dmed, nil
+}
+
+// nominate stores the nomination and lets the nominee know in their IM
+// channel im, it returns their name if we can find it
+func (s *server) nominate(n nomination, im string) (string, error) {
+	nominations := []nomination{}
+	err := s.store.update(nominationsKey, &nominations, func() error {
+		nominations = append(nominations, n)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	text := "Wohoo! Someone just nominated you for being a " + s.behaviourName(n.Behaviour) + "!"
+	if n.Message != "" || n.Link == "" {
+		text += "\n They said \"" + n.Message + "\""
+	}
+	if n.Link != "" {
+		text += "\n It was for <" + n.Link + "|this message>"
+	}
+	s.slack.SendMessage(s.slack.NewOutgoingMessage(text, im))
+
+	u, err := s.slack.GetUserInfo(n.Nominee)
+	if err != nil {
+		return "", nil
+	}
+	return u.RealName, nil
+}
+
+// hwrReaction nominates the author of a message when someone reacts to it
+// with one of the behaviour emojis, it returns true if the author was DMed
+func (s *server) hwrReaction(user, author, reaction, channel, ts string, now time.Time) (bool, error) {
+	bot := s.slack.GetInfo().User.ID
+	if author == "" || author == user || author == bot || user == bot {
+		return false, nil
+	}
+	b, ok := s.config.HWR.emojiBehaviour(reaction)
+	if !ok {
+		return false, nil
+	}
+
+	// taking the reaction off and putting it back on doesn't count twice
+	link := s.permalink(channel, ts)
+	var nominations []nomination
+	err := s.store.load(nominationsKey, &nominations)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range nominations {
+		if n.Nominator == user && n.Nominee == author && n.Behaviour == b.Code && n.Link == link {
+			return false, nil
+		}
+	}
+
+	_, _, c, err := s.slack.OpenIMChannel(author)
+	if err != nil {
+		return false, errors.Wrapf(err, "Could not open an IM channel to: %s", author)
+	}
+	_, err = s.nominate(nomination{Nominee: author, Behaviour: b.Code, Time: now, Nominator: user, Link: link}, c)
+	return err == nil, err
+}
+
+// permalink is a link to a message, slack's are
+// https://<team>.slack.com/archives/<channel>/p<ts without the dot>
+func (s *server) permalink(channel, ts string) string {
+	domain := "app"
+	if info := s.slack.GetInfo(); info.Team != nil && info.Team.Domain != "" {
+		domain = info.Team.Domain
+	}
+	return "https://" + domain + ".slack.com/archives/" + channel + "/p" + strings.Replace(ts, ".", "", 1)
+}
+
+func (s *server) hwrBehaviours() string {
+	var r strings.Builder
+	r.WriteString("You can recognise people for being a:\n")
+	for _, b := range s.config.HWR.behaviours() {
+		r.WriteString(strings.ToUpper(b.Code) + " - " + b.Name)
+		if b.Emoji != "" {
+			r.WriteString(" :" + b.Emoji + ":")
+		}
+		if b.Description != "" {
+			r.WriteString(", " + b.Description)
+		}
+		r.WriteString("\n")
+	}
+	r.WriteString("eg. hwr @ruskin.dantra CC It was awesome when you rapped for all of us")
+	return r.String()
+}
+
+func (s *server) behaviourCodes() string {
+	var codes []string
+	for _, b := range s.config.HWR.behaviours() {
+		codes = append(codes, strings.ToUpper(b.Code)+" ("+b.Name+")")
+	}
+	return strings.Join(codes, ", ")
+}
+
+// behaviourName falls back to the code for behaviours that have since been
+// taken out of the config
+func (s *server) behaviourName(code string) string {
+	if b, ok := s.config.HWR.behaviour(code); ok {
+		return b.Name
+	}
+	return code
+}
+
+func joinNames(names []string) string {
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// hwrStats counts the nominations for each behaviour
+func (s *server) hwrStats() (string, error) {
+	var nominations []nomination
+	err := s.store.load(nominationsKey, &nominations)
+	if err != nil {
+		return "", err
+	}
+	if len(nominations) == 0 {
+		return "Nobody has been recognised yet, be the first with hwr <user handle> <2 letter behaviour initial> <message>", nil
+	}
+
+	counts := make(map[string]int)
+	for _, n := range nominations {
+		counts[n.Behaviour]++
+	}
+	var codes []string
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if counts[codes[i]] == counts[codes[j]] {
+			return codes[i] < codes[j]
+		}
+		return counts[codes[i]] > counts[codes[j]]
+	})
+
+	var r strings.Builder
+	r.WriteString("Recognitions so far:\n")
+	for _, code := range codes {
+		r.WriteString(fmt.Sprintf("%s: %d\n", s.behaviourName(code), counts[code]))
+	}
+	r.WriteString("Total: " + strconv.Itoa(len(nominations)))
+	return r.String(), nil
+}
+
+// hwrLeaderboard is who has been recognised the most this month
+func (s *server) hwrLeaderboard(now time.Time) (string, error) {
+	var nominations []nomination
+	err := s.store.load(nominationsKey, &nominations)
+	if err != nil {
+		return "", err
+	}
+
+	nz := loadLocation("Pacific/Auckland")
+	now = now.In(nz)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, nz)
+	counts := make(map[string]int)
+	for _, n := range nominations {
+		if !n.Time.Before(start) {
+			counts[n.Nominee]++
+		}
+	}
+	if len(counts) == 0 {
+		return "Nobody has been recognised in " + now.Format("January") + " yet", nil
+	}
+
+	var nominees []string
+	for n := range counts {
+		nominees = append(nominees, n)
+	}
+	sort.Slice(nominees, func(i, j int) bool {
+		if counts[nominees[i]] == counts[nominees[j]] {
+			return nominees[i] < nominees[j]
+		}
+		return counts[nominees[i]] > counts[nominees[j]]
+	})
+	if len(nominees) > 10 {
+		nominees = nominees[:10]
+	}
+
+	var r strings.Builder
+	r.WriteString("Most recognised in " + now.Format("January") + ":\n")
+	for i, n := range nominees {
+		r.WriteString(fmt.Sprintf("%d. <@%s> %d\n", i+1, n, counts[n]))
+	}
+	return strings.TrimSuffix(r.String(), "\n"), nil
+}
+
+// postHWRDigest celebrates the last week's recognitions in the team channel,
+// without saying who nominated who
+func (s *server) postHWRDigest(now time.Time) error {
+	var nominations []nomination
+	err := s.store.load(nominationsKey, &nominations)
+	if err != nil {
+		return err
+	}
+
+	var r strings.Builder
+	for _, n := range nominations {
+		if n.Time.Before(now.AddDate(0, 0, -7)) || n.Time.After(now) {
+			continue
+		}
+		emoji := "tada"
+		if b, ok := s.config.HWR.behaviour(n.Behaviour); ok && b.Emoji != "" {
+			emoji = b.Emoji
+		}
+		r.WriteString(":" + emoji + ": <@" + n.Nominee + "> for being a " + s.behaviourName(n.Behaviour))
+		if n.Message != "" {
+			r.WriteString(": \"" + n.Message + "\"")
+		} else if n.Link != "" {
+			r.WriteString(" in <" + n.Link + "|this message>")
+		}
+		r.WriteString("\n")
+	}
+	if r.Len() == 0 {
+		return nil
+	}
+
+	s.slack.SendMessage(s.slack.NewOutgoingMessage("This week's HWR recognitions:\n"+r.String(), teamChannelID))
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+var exportDateFormats = []string{"2006-01-02", "2 Jan 2006", "2 January 2006"}
+
+// hwrExport sends someone a file of the recognitions a person has received,
+// eg. hwr export <@U123> since 2018-04-01 csv. Only managers can export
+// other people's, and it never says who made the nominations
+func (s *server) hwrExport(user string, words []string, now time.Time) (string, error) {
+	usage := "Try hwr export @ruskin.dantra since 2018-04-01, add csv on the end for a spreadsheet"
+	users, words := parseMentions(words)
+	if len(users) != 1 {
+		return usage, nil
+	}
+	nominee := users[0]
+	if nominee != strings.ToUpper(user) && !s.config.HWR.isManager(user) {
+		return "Sorry, only managers can export other people's recognitions", nil
+	}
+
+	format := "markdown"
+	if len(words) > 0 {
+		switch strings.ToLower(words[len(words)-1]) {
+		case "csv":
+			format = "csv"
+			words = words[:len(words)-1]
+		case "markdown", "md":
+			words = words[:len(words)-1]
+		}
+	}
+	var since time.Time
+	if len(words) > 0 {
+		if strings.ToLower(words[0]) != "since" || len(words) == 1 {
+			return usage, nil
+		}
+		var err error
+		since, err = parseExportDate(strings.Join(words[1:], " "))
+		if err != nil {
+			return "I don't know when " + strings.Join(words[1:], " ") + " is, " + usage, nil
+		}
+	}
+
+	var nominations []nomination
+	err := s.store.load(nominationsKey, &nominations)
+	if err != nil {
+		return "", err
+	}
+	var received []nomination
+	for _, n := range nominations {
+		if n.Nominee == nominee && !n.Time.Before(since) && !n.Time.After(now) {
+			received = append(received, n)
+		}
+	}
+	sort.SliceStable(received, func(i, j int) bool { return received[i].Time.Before(received[j].Time) })
+
+	name := nominee
+	if u, err := s.slack.GetUserInfo(nominee); err == nil && u.RealName != "" {
+		name = u.RealName
+	}
+	period := "ever"
+	if !since.IsZero() {
+		period = "since " + since.Format("2 January 2006")
+	}
+	if len(received) == 0 {
+		return name + " hasn't been recognised " + period + " yet", nil
+	}
+
+	var data []byte
+	filename := "hwr-" + strings.Replace(strings.ToLower(name), " ", "-", -1)
+	if format == "csv" {
+		data, err = s.exportCSV(received)
+		filename += ".csv"
+	} else {
+		data = []byte(s.exportMarkdown(name, period, received))
+		filename += ".md"
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, _, c, err := s.slack.OpenIMChannel(user)
+	if err != nil {
+		return "", errors.Wrapf(err, "Could not open an IM channel to: %s", user)
+	}
+	title := fmt.Sprintf("HWR recognitions for %s %s", name, period)
+	_, err = s.slack.UploadFile(slack.FileUploadParameters{
+		Reader:   bytes.NewReader(data),
+		Filetype: format,
+		Filename: filename,
+		Title:    title,
+		Channels: []string{c},
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "Could not upload HWR export for %s", nominee)
+	}
+	return fmt.Sprintf("I've DMed you %d %s for %s", len(received), plural(len(received), "recognition"), name), nil
+}
+
+func parseExportDate(text string) (time.Time, error) {
+	nz := loadLocation("Pacific/Auckland")
+	for _, f := range exportDateFormats {
+		if t, err := time.ParseInLocation(f, text, nz); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("Not a date: %s", text)
+}
+
+func (s *server) exportCSV(received []nomination) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"date", "behaviour", "message", "link"})
+	for _, n := range received {
+		w.Write([]string{n.Time.In(loadLocation("Pacific/Auckland")).Format("2006-01-02"), s.behaviourName(n.Behaviour), n.Message, n.Link})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, errors.Wrap(err, "Could not write HWR export")
+	}
+	return buf.Bytes(), nil
+}
+
+// exportMarkdown is a count for each behaviour, then every recognition
+func (s *server) exportMarkdown(name, period string, received []nomination) string {
+	counts := make(map[string]int)
+	var codes []string
+	for _, n := range received {
+		if counts[n.Behaviour] == 0 {
+			codes = append(codes, n.Behaviour)
+		}
+		counts[n.Behaviour]++
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if counts[codes[i]] == counts[codes[j]] {
+			return codes[i] < codes[j]
+		}
+		return counts[codes[i]] > counts[codes[j]]
+	})
+
+	var r strings.Builder
+	r.WriteString("# HWR recognitions for " + name + " " + period + "\n\n")
+	for _, code := range codes {
+		r.WriteString(fmt.Sprintf("- %s: %d\n", s.behaviourName(code), counts[code]))
+	}
+	r.WriteString("\n| Date | Behaviour | Message |\n| --- | --- | --- |\n")
+	for _, n := range received {
+		m := strings.Replace(n.Message, "|", "\\|", -1)
+		if m == "" && n.Link != "" {
+			m = "[reaction](" + n.Link + ")"
+		}
+		r.WriteString(fmt.Sprintf("| %s | %s | %s |\n", n.Time.In(loadLocation("Pacific/Auckland")).Format("2 Jan 2006"), s.behaviourName(n.Behaviour), m))
+	}
+	return r.String()
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+// calendarEventsKey - the events we've already put on the board from calendars
+const calendarEventsKey = "calendar_events"
+
+// icsEvent - the bits of a VEVENT we put on the board
+type icsEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Start       time.Time
+}
+
+var eventbriteID = regexp.MustCompile(`-(\d+)$`)
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+var icsUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+// icsFeedURL works out where to get an ics file for a link, either it is one
+// already or it is an event page on a site we know the ics feed for
+func icsFeedURL(link string) (string, bool) {
+	link = strings.TrimPrefix(strings.TrimSpace(link), "<")
+	link = strings.TrimSuffix(link, ">")
+	if i := strings.Index(link, "|"); i != -1 {
+		link = link[:i]
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	if u.Scheme == "webcal" {
+		u.Scheme = "https"
+	}
+	host := strings.ToLower(u.Hostname())
+	path := strings.TrimSuffix(u.Path, "/")
+
+	switch {
+	case strings.HasSuffix(strings.ToLower(path), ".ics"):
+		return u.String(), true
+
+	// https://www.eventbrite.co.nz/e/gophers-night-tickets-49920412345
+	case strings.Contains(host, "eventbrite.") && strings.HasPrefix(path, "/e/"):
+		m := eventbriteID.FindStringSubmatch(path)
+		if m == nil {
+			return "", false
+		}
+		return "https://www.eventbrite.com/calendar.ics?eid=" + m[1] + "&calendar=ical", true
+
+	// https://lu.ma/gophers
+	case host == "lu.ma" && path != "" && strings.Count(path, "/") == 1:
+		return "https://api.lu.ma/ics/get?entity=event&id=" + url.QueryEscape(path[1:]), true
+	}
+	return "", false
+}
+
+func isCalendarFile(f *slack.File) bool {
+	return f != nil && (f.Filetype == "ics" || strings.HasSuffix(strings.ToLower(f.Name), ".ics"))
+}
+
+// addCalendarLink adds the upcoming events from an ics link to the meetups list
+func (s *server) addCalendarLink(client *http.Client, link, channel string) (string, error) {
+	feed, ok := icsFeedURL(link)
+	if !ok {
+		return "", errors.Errorf("Not a calendar link: %s", link)
+	}
+
+	req, err := http.NewRequest("GET", feed, nil)
+	if err != nil {
+		return "", err
+	}
+	return s.addCalendarEvents(client, req, channel)
+}
+
+// addCalendarFile adds the upcoming events from an ics file shared in slack
+func (s *server) addCalendarFile(client *http.Client, f *slack.File, channel string) (string, error) {
+	req, err := http.NewRequest("GET", f.URLPrivateDownload, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Authorization", "Bearer "+s.slackToken)
+	return s.addCalendarEvents(client, req, channel)
+}
+
+// addCalendarEvents puts each upcoming event on the board and announces it in
+// channel like any other meetup, events we've added before are left alone
+func (s *server) addCalendarEvents(client *http.Client, req *http.Request, channel string) (string, error) {
+	events, skipped, err := fetchICS(client, req)
+	if err != nil {
+		return "", err
+	}
+
+	imported := make(map[string]bool)
+	err = s.store.load(calendarEventsKey, &imported)
+	if err != nil {
+		return "", err
+	}
+
+	var resp []string
+	upcoming := 0
+	now := time.Now()
+	for _, e := range events {
+		if e.Start.Before(now) {
+			continue
+		}
+		upcoming++
+		if imported[e.key()] {
+			resp = append(resp, e.Summary+" is already on the trello board")
+			continue
+		}
+
+		start := e.Start
+		item := &backlogItem{Title: e.Summary, Description: e.description(), URL: e.URL, Due: &start}
+		r, err := s.recordMeetup(item, e.Summary, channel, "I've added "+e.Summary+" from that calendar to the trello board for you :)")
+		if err != nil {
+			return strings.Join(resp, "\n"), err
+		}
+		if r != "" {
+			resp = append(resp, r)
+		}
+		err = s.store.update(calendarEventsKey, &imported, func() error {
+			imported[e.key()] = true
+			return nil
+		})
+		if err != nil {
+			return strings.Join(resp, "\n"), err
+		}
+	}
+
+	if upcoming == 0 {
+		resp = append(resp, "I couldn't find any upcoming events in that calendar")
+	}
+	for _, sk := range skipped {
+		resp = append(resp, "I skipped "+sk)
+	}
+	return strings.Join(resp, "\n"), nil
+}
+
+// key identifies an event across calendars, falling back to what and when
+// for calendars that don't give their events a UID
+func (e icsEvent) key() string {
+	if e.UID != "" {
+		return e.UID
+	}
+	return e.Summary + "@" + e.Start.UTC().Format(time.RFC3339)
+}
+
+// fetchICS gets the events in a calendar, and why any it couldn't read were skipped
+func fetchICS(client *http.Client, req *http.Request) ([]icsEvent, []string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Could not make request to %s", req.URL)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Could not read request for %s", req.URL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, errors.Errorf("Got %d for %s", resp.StatusCode, req.URL)
+	}
+
+	events, skipped, err := parseICS(data)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Could not parse calendar from %s", req.URL)
+	}
+	return events, skipped, nil
+}
+
+func (e icsEvent) description() string {
+	var d []string
+	if e.Location != "" {
+		d = append(d, "Venue: "+e.Location)
+	}
+	if e.Description != "" {
+		d = append(d, e.Description)
+	}
+	if e.URL != "" {
+		d = append(d, e.URL)
+	}
+	return strings.Join(d, "\n")
+}
+
+// parseICS reads the VEVENTs out of an ics file, it only understands as much
+// of RFC 5545 as event invites tend to use. Events we can't work out the
+// start of are skipped rather than failing the whole file, skipped says why
+func parseICS(data []byte) ([]icsEvent, []string, error) {
+	var events []icsEvent
+	var skipped []string
+	var current *icsEvent
+	var startErr error
+
+	for _, line := range unfoldICS(data) {
+		name, params, value := splitICSLine(line)
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &icsEvent{}
+			startErr = nil
+		case name == "END" && value == "VEVENT":
+			if current == nil {
+				return nil, nil, errors.New("END:VEVENT without BEGIN:VEVENT")
+			}
+			switch {
+			case startErr != nil:
+				skipped = append(skipped, current.name()+": "+startErr.Error())
+			case current.Start.IsZero():
+				skipped = append(skipped, current.name()+": it has no start")
+			default:
+				events = append(events, *current)
+			}
+			current = nil
+		case current == nil:
+			continue
+		case name == "UID":
+			current.UID = value
+		case name == "SUMMARY":
+			current.Summary = icsUnescaper.Replace(value)
+		case name == "DESCRIPTION":
+			current.Description = icsUnescaper.Replace(value)
+		case name == "LOCATION":
+			current.Location = icsUnescaper.Replace(value)
+		case name == "URL":
+			current.URL = value
+		case name == "DTSTART":
+			current.Start, startErr = parseICSTime(params, value)
+		}
+	}
+	return events, skipped, nil
+}
+
+func (e icsEvent) name() string {
+	if e.Summary != "" {
+		return e.Summary
+	}
+	if e.UID != "" {
+		return "event " + e.UID
+	}
+	return "an event"
+}
+
+// unfoldICS joins continuation lines, which start with a space or a tab
+func unfoldICS(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// splitICSLine splits eg. DTSTART;TZID=Pacific/Auckland:20180920T180000
+func splitICSLine(line string) (string, map[string]string, string) {
+	colon := strings.Index(line, ":")
+	if colon == -1 {
+		return strings.ToUpper(line), nil, ""
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	params := make(map[string]string)
+	for _, p := range parts[1:] {
+		if kv := strings.SplitN(p, "=", 2); len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+func parseICSTime(params map[string]string, value string) (time.Time, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.Parse("20060102", value)
+		return t, errors.Wrapf(err, "Could not parse calendar date: %s", value)
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, errors.Wrapf(err, "Could not parse calendar time: %s", value)
+	}
+
+	loc := time.UTC
+	if tz, ok := params["TZID"]; ok {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "Unknown calendar timezone: %s", tz)
+		}
+		loc = l
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, errors.Wrapf(err, "Could not parse calendar time: %s", value)
+}
+
+// writeICS writes a calendar of the items with a due date, so people can subscribe to the board
+func writeICS(w io.Writer, name string, items []backlogItem, now time.Time) error {
+	var b strings.Builder
+	line := func(l string) {
+		// lines are folded at 75 octets
+		for len(l) > 75 {
+			cut := 75
+			for cut > 0 && (l[cut]&0xC0) == 0x80 {
+				cut--
+			}
+			b.WriteString(l[:cut] + "\r\n")
+			l = " " + l[cut:]
+		}
+		b.WriteString(l + "\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//rudolph//talks//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + icsEscaper.Replace(name))
+	for _, i := range items {
+		if i.Due == nil {
+			continue
+		}
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:%s-%s@rudolph", i.List, i.ID))
+		line("DTSTAMP:" + now.UTC().Format("20060102T150405Z"))
+		line("DTSTART:" + i.Due.UTC().Format("20060102T150405Z"))
+		line("SUMMARY:" + icsEscaper.Replace(i.Title))
+		if i.Description != "" {
+			line("DESCRIPTION:" + icsEscaper.Replace(i.Description))
+		}
+		if i.URL != "" {
+			line("URL:" + i.URL)
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (s *server) handleCalendar(name string, lists ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var items []backlogItem
+		for _, l := range lists {
+			i, err := s.backlog.Items(l)
+			if err != nil {
+				fmt.Printf("Error: Could not get items for calendar: %s\n", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			items = append(items, i...)
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		if err := writeICS(w, name, items, time.Now()); err != nil {
+			fmt.Printf("Error: Could not write calendar: %s\n", err)
+		}
+	}
+}
@@ -1,15 +1,13 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
-	"github.com/adlio/trello"
 	"github.com/nlopes/slack"
 	"github.com/pkg/errors"
 )
@@ -18,6 +16,8 @@ const (
 	ideasListID     = "5b613db79ea6a782ac173a48"
 	scheduledListID = "5b613dbfd923da512f85263b"
 	meetupsListID   = "5b6140b0ff2ec75df864657f"
+
+	teamChannelID = "CBLRCPPRQ"
 )
 
 func main() {
@@ -27,9 +27,21 @@ func main() {
 }
 
 type server struct {
-	trello TrelloClient
-	slack  SlackRTMInterface
-	done   chan struct{}
+	backlog  backlog
+	carpools carpoolService
+	quotes   QuoteProvider
+	trello   TrelloClient
+	cache    *listCache
+	users    *userCache
+	slack    SlackRTMInterface
+	store    *store
+	config   config
+	sched    *scheduler
+	webhook  webhookConfig
+	done     chan struct{}
+
+	addr       string
+	slackToken string
 }
 
 func newServer() server {
@@ -37,10 +49,60 @@ func newServer() server {
 	trello := os.Getenv("TRELLO_TOKEN")
 	slack := os.Getenv("SLACK_TOKEN")
 
+	cfg, err := loadConfig(os.Getenv("RUDOLPH_CONFIG"))
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		os.Exit(1)
+	}
+	cfg.Backlog.token = os.Getenv("GITHUB_TOKEN")
+
+	// trello is only wired up when it is what the backlog is on
+	var client TrelloClient
+	var cache *listCache
+	if cfg.Backlog.Backend == "" || cfg.Backlog.Backend == "trello" {
+		client = newTrelloClient(appKey, trello)
+		cache = newListCache(client, realClock{}, cacheTTL)
+	}
+
+	b, err := newBacklog(cfg.Backlog, client, cache)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	quotes, err := newQuoteProvider(cfg.Shares, &http.Client{})
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+
+	st := newStore(dataDir)
+
 	return server{
-		trello: newTrelloClient(appKey, trello),
-		slack:  newSlackRTM(slack),
-		done:   make(chan struct{}),
+		backlog:  b,
+		carpools: newCarpoolService(cfg.Carpool, &http.Client{}, st),
+		quotes:   quotes,
+		trello:   client,
+		cache:    cache,
+		users:    newUserCache(realClock{}, userCacheTTL),
+		slack:    newSlackRTM(slack),
+		store:    st,
+		config:   cfg,
+		webhook: webhookConfig{
+			boardID:     os.Getenv("TRELLO_BOARD_ID"),
+			secret:      os.Getenv("TRELLO_SECRET"),
+			callbackURL: os.Getenv("TRELLO_WEBHOOK_URL"),
+			token:       trello,
+		},
+		done: make(chan struct{}),
+
+		addr:       os.Getenv("HTTP_ADDR"),
+		slackToken: slack,
 	}
 }
 
@@ -48,14 +110,25 @@ func (s *server) start() {
 	fmt.Println("Starting")
 
 	// check all external meetups and send out a reminder for any today
-	resp, err := s.getMeetupReminders()
+	resp, err := s.getMeetupReminders(time.Now())
 	if err != nil {
 		fmt.Printf("Error: %s\n", err)
 	} else if resp != "" {
 		time.Sleep(1000 * time.Millisecond)
-		s.slack.SendMessage(s.slack.NewOutgoingMessage(resp, "CBLRCPPRQ"))
+		s.slack.SendMessage(s.slack.NewOutgoingMessage(resp, teamChannelID))
 	}
 
+	if s.addr != "" {
+		if err := s.listen(); err != nil {
+			fmt.Printf("Error: %s\n", err)
+		}
+	}
+
+	if s.sched == nil {
+		s.sched = newScheduler(realClock{})
+	}
+	s.schedule()
+
 	go func(done chan struct{}, s *server) {
 		for {
 			select {
@@ -77,25 +150,38 @@ func (s *server) start() {
 					if err != nil {
 						fmt.Printf("Error: %s\n", err)
 					}
-					// TODO: Move the prefix check to processMessage
-					if msg.User != info.User.ID && (strings.HasPrefix(msg.Text, prefix) || strings.HasPrefix(msg.Text, "<https://www.meetup.com/")) {
+					if resp != "" {
 						s.slack.SendMessage(s.slack.NewOutgoingMessage(resp, msg.Channel))
 					}
 
-				case *slack.RTMError:
-					fmt.Printf("Error: %s\n", msg.Error())
-
-				case *slack.LatencyReport:
-					// send scheduled updates to me
-					if shouldSendUpdate(realClock{}) {
-						r, err := getScheduledUpdate(&http.Client{})
+				case *slack.ReactionAddedEvent:
+					s.handleReaction(msg.User, msg.Reaction, msg.Item.Timestamp, true)
+					if _, ok := s.config.HWR.emojiBehaviour(msg.Reaction); ok {
+						now := s.sched.clock.Now()
+						resp, err := s.guardDMs(msg.User, "hwr reaction", []string{msg.ItemUser}, now, func() (string, []string, error) {
+							dmed, err := s.hwrReaction(msg.User, msg.ItemUser, msg.Reaction, msg.Item.Channel, msg.Item.Timestamp, now)
+							if dmed {
+								return "", []string{msg.ItemUser}, err
+							}
+							return "", nil, err
+						})
 						if err != nil {
 							fmt.Printf("Error: %s\n", err)
-						} else {
-							s.slack.SendMessage(s.slack.NewOutgoingMessage(r, "DCKGBPU10"))
+						}
+						if resp != "" {
+							s.sendDM(msg.User, resp)
 						}
 					}
 
+				case *slack.ReactionRemovedEvent:
+					s.handleReaction(msg.User, msg.Reaction, msg.Item.Timestamp, false)
+
+				case *slack.RTMError:
+					fmt.Printf("Error: %s\n", msg.Error())
+
+				case *slack.LatencyReport:
+					s.sched.tick()
+
 				case *slack.InvalidAuthEvent:
 					fmt.Printf("Invalid credentials")
 					close(done)
@@ -108,83 +194,251 @@ func (s *server) start() {
 	}(s.done, s)
 }
 
+// listen serves trello webhooks and calendars, it has to be up before we
+// register the webhook because trello checks the callback url when it is created
+func (s *server) listen() error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return errors.Wrapf(err, "Could not listen on %s", s.addr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/trello", s.handleTrelloWebhook)
+	mux.HandleFunc("/calendar.ics", s.handleCalendar("Meetups and talks", meetupsList, scheduledList))
+	mux.HandleFunc("/meetups.ics", s.handleCalendar("Meetups", meetupsList))
+	mux.HandleFunc("/scheduled.ics", s.handleCalendar("Scheduled talks", scheduledList))
+	srv := &http.Server{Handler: mux}
+
+	go srv.Serve(l)
+	go func() {
+		<-s.done
+		srv.Close()
+	}()
+
+	if s.trello != nil && s.webhook.boardID != "" && s.webhook.callbackURL != "" {
+		return s.registerTrelloWebhook()
+	}
+	return nil
+}
+
+// schedule sets up everything rudolph does on its own
+func (s *server) schedule() {
+	nz := loadLocation("Pacific/Auckland")
+
+	s.sched.add("meetup digest", weekly(nz, time.Monday, 9, 0), func() error {
+		return s.postMeetupDigest(&http.Client{}, s.sched.clock.Now())
+	})
+	s.sched.add("watchlist updates", every(time.Minute), func() error {
+		return s.sendWatchlistUpdates(s.sched.clock)
+	})
+	s.sched.add("price alerts", every(5*time.Minute), func() error {
+		return s.checkAlerts(s.sched.clock.Now())
+	})
+	s.sched.add("hwr digest", weekly(nz, time.Friday, 16, 0), func() error {
+		return s.postHWRDigest(s.sched.clock.Now())
+	})
+	s.sched.add("wake up nudges", every(time.Minute), func() error {
+		return s.nudgeWakeUps(s.sched.clock.Now())
+	})
+	s.sched.add("rotations", weekly(nz, time.Monday, 9, 0), func() error {
+		return s.announceRotations(s.sched.clock.Now())
+	})
+	s.sched.add("standups", every(time.Minute), func() error {
+		return s.runStandups(s.sched.clock.Now())
+	})
+	if s.config.Carpool.local() {
+		s.sched.add("carpool sign-up", daily(nz, 14, 0), func() error {
+			return s.postCarpoolSignup(s.sched.clock.Now())
+		})
+		s.sched.add("carpool matches", daily(nz, 17, 0), func() error {
+			return s.sendCarpoolMatches(s.sched.clock.Now())
+		})
+	}
+}
+
 func (s *server) stop() {
 	close(s.done)
 }
 
+func (s *server) handleReaction(user, reaction, ts string, added bool) {
+	if user == s.slack.GetInfo().User.ID {
+		return
+	}
+
+	if err := s.recordRSVP(user, reaction, ts, added); err != nil {
+		fmt.Printf("Error: %s\n", err)
+	}
+	if err := s.carpoolSignup(user, reaction, ts, added); err != nil {
+		fmt.Printf("Error: %s\n", err)
+	}
+	if added {
+		if err := s.ackWakeUp(user, ts); err != nil {
+			fmt.Printf("Error: %s\n", err)
+		}
+		if err := s.confirmMeetups(&http.Client{}, reaction, ts); err != nil {
+			fmt.Printf("Error: %s\n", err)
+		}
+		if err := s.addRecommendation(reaction, ts); err != nil {
+			fmt.Printf("Error: %s\n", err)
+		}
+	}
+}
+
+// processMessage returns what to reply with, if anything
 func (s *server) processMessage(msg *slack.MessageEvent, info *slack.Info, prefix string, slack SlackRTMInterface) (string, error) {
+	// slack unfurls links by editing the message, so look in the new version for meetups
+	if msg.SubType == "message_changed" && msg.SubMessage != nil {
+		if msg.SubMessage.User == info.User.ID || strings.HasPrefix(msg.SubMessage.Text, prefix) {
+			return "", nil
+		}
+		return "", s.offerMeetups(msg.Channel, msg.SubMessage.Timestamp, meetupLinks(msg.SubMessage.Text, msg.SubMessage.Attachments))
+	}
+	if msg.User == info.User.ID {
+		return "", nil
+	}
+
+	if isCalendarFile(msg.File) && strings.HasPrefix(msg.Text, prefix) {
+		return s.addCalendarFile(&http.Client{}, msg.File, msg.Channel)
+	}
+	if !strings.HasPrefix(msg.Text, prefix) && strings.HasPrefix(msg.Channel, "D") {
+		// wake ups tell people to reply snooze, without mentioning us
+		if dm := strings.ToLower(strings.TrimSpace(msg.Text)); isSnoozeReply(dm) {
+			return s.snoozeWakeUps(msg.User, dm, s.sched.clock.Now())
+		}
+		// DMs might be answers to standup questions
+		resp, ok, err := s.standupAnswer(msg.User, msg.Channel, msg.Text)
+		if ok || err != nil {
+			return resp, err
+		}
+	}
+	if !strings.HasPrefix(msg.Text, prefix) {
+		// not for us, but we can offer to add any meetups they mentioned
+		return "", s.offerMeetups(msg.Channel, msg.Timestamp, meetupLinks(msg.Text, msg.Attachments))
+	}
+
 	text := strings.TrimPrefix(msg.Text, prefix)
 	text = strings.TrimSpace(text)
 	text = strings.ToLower(text)
 
-	if text == "who wants to carpool tomorrow" {
-		return getPassengers(&http.Client{})
+	if strings.HasPrefix(text, "who wants to carpool") {
+		return s.getPassengers(text, time.Now())
+	} else if strings.HasPrefix(text, "carpool") {
+		return s.carpool(msg.User, text, time.Now())
 	} else if strings.HasPrefix(text, "hwr") {
-		return hwr(text, slack)
+		original := strings.TrimSpace(strings.TrimPrefix(msg.Text, prefix))
+		nominees, _ := parseMentions(strings.Fields(original)[1:])
+		return s.guardDMs(msg.User, "hwr", nominees, time.Now(), func() (string, []string, error) {
+			return s.hwr(msg.User, original, time.Now())
+		})
 	} else if strings.HasSuffix(text, "scheduled") {
-		return s.getListItems(scheduledListID)
+		return s.getListItems(scheduledList)
 	} else if strings.HasSuffix(text, "ideas") {
-		return s.getListItems(ideasListID)
+		return s.getListItems(ideasList)
 	} else if strings.HasPrefix(text, "add") {
 		return s.addIdea(text)
+	} else if strings.HasPrefix(text, "schedule") {
+		return s.scheduleIdea(text)
+	} else if strings.HasPrefix(text, "watchlist") || strings.HasPrefix(text, "my watchlist") {
+		return s.watchlistCommand(msg.User, strings.TrimSpace(strings.TrimPrefix(msg.Text, prefix)))
+	} else if strings.HasPrefix(text, "watch ") {
+		return s.watch(msg.User, text)
+	} else if strings.HasPrefix(text, "unwatch ") {
+		return s.unwatch(msg.User, text)
+	} else if strings.HasPrefix(text, "alert") || text == "my alerts" || strings.HasPrefix(text, "cancel alert") {
+		return s.alert(msg.User, text)
+	} else if strings.HasPrefix(text, "portfolio") {
+		return s.portfolio(msg.User, text)
+	} else if strings.HasPrefix(text, "standup") {
+		return s.standupCommand(msg.User, msg.Channel, strings.TrimSpace(strings.TrimPrefix(msg.Text, prefix)), s.sched.clock.Now())
+	} else if strings.HasPrefix(text, "rotation") {
+		return s.rotationCommand(msg.Channel, text, s.sched.clock.Now())
+	} else if strings.HasPrefix(text, "chart") {
+		return s.chart(msg.Channel, text)
 	} else if strings.HasPrefix(text, "price") {
-		return getSharePrice(&http.Client{}, text)
+		return getSharePrice(s.quotes, text)
 	} else if text == "make me laugh" {
 		return getDadJoke(&http.Client{})
 	} else if text == "help" {
 		return getHelp(), nil
 	} else if strings.HasPrefix(text, "wake up") {
-		return wakeUp(text, slack)
+		original := strings.TrimSpace(strings.TrimPrefix(msg.Text, prefix))
+		targets, _ := parseMentions(strings.Fields(original)[2:])
+		// the same clock as the nudges, so snoozes and do not disturb line up
+		now := s.sched.clock.Now()
+		return s.guardDMs(msg.User, "wake up", targets, now, func() (string, []string, error) {
+			resp, pinged, err := s.wakeUp(msg.User, msg.Channel, original, now)
+			if pinged {
+				return resp, targets, err
+			}
+			return resp, nil, err
+		})
+	} else if text == "stop pinging me" || text == "start pinging me" {
+		return s.optOutOfDMs(msg.User, text)
+	} else if strings.HasPrefix(text, "snooze") || text == "unsnooze" {
+		return s.snoozeWakeUps(msg.User, text, s.sched.clock.Now())
 	} else if strings.HasPrefix(text, "who") && strings.HasSuffix(text, "risk") {
 		return getRisk(), nil
+	} else if strings.HasPrefix(text, "who") && strings.Contains(text, "going to") {
+		return s.whosGoing(text)
 	} else if strings.HasPrefix(text, "who") {
-		return getRandomUserFromChannel(msg.Channel, slack)
-	} else if strings.HasPrefix(text, "<https://www.meetup.com/") {
-		return s.addMeetup(&http.Client{}, text)
+		return s.pickUser(msg.Channel, strings.TrimSpace(strings.TrimPrefix(msg.Text, prefix)))
+	} else if links := meetupLinks(msg.Text, nil); len(links) > 0 {
+		// after the commands, so a link in an idea or a hwr doesn't become a meetup.
+		// They asked us directly, so no need to check
+		return s.addMeetups(&http.Client{}, links, msg.Channel)
+	} else if _, ok := icsFeedURL(text); ok {
+		// links can be case sensitive, so use what they actually sent
+		return s.addCalendarLink(&http.Client{}, strings.TrimPrefix(msg.Text, prefix), msg.Channel)
 	} else if strings.HasSuffix(text, "performance rating") {
 		return getRating(), nil
 	}
 	return getContribute(), nil
 }
 
-func (s *server) getListItems(listID string) (string, error) {
-	cards, err := getCards(s.trello, listID)
+func (s *server) getListItems(list string) (string, error) {
+	items, err := s.backlog.Items(list)
 	if err != nil {
-		return "", errors.Wrapf(err, "Could not get card titles for list: %s", listID)
+		return "", errors.Wrapf(err, "Could not get card titles for list: %s", list)
 	}
 
 	var response strings.Builder
-	for _, c := range cards {
-		response.WriteString(c.Name)
+	for _, i := range items {
+		response.WriteString(i.Title)
 		response.WriteString("\n")
 	}
 
 	return response.String(), nil
 }
 
-func (s *server) getMeetupReminders() (string, error) {
-	cards, err := getCards(s.trello, meetupsListID)
+// getMeetupReminders lists the meetups on today in New Zealand, due dates
+// come back from the backlog in UTC so morning meetups are the day before
+func (s *server) getMeetupReminders(now time.Time) (string, error) {
+	items, err := s.backlog.Items(meetupsList)
 	if err != nil {
-		return "", errors.Wrapf(err, "Could not get card titles for list: %s", meetupsListID)
+		return "", errors.Wrapf(err, "Could not get card titles for list: %s", meetupsList)
 	}
 
 	var response strings.Builder
 	var title = "It's your lucky day, we have a meetup later today:\n"
 	response.WriteString(title)
 
-	loc, err := time.LoadLocation("UTC")
+	nz := loadLocation("Pacific/Auckland")
+	yy, mm, dd := now.In(nz).Date()
+
+	rsvps, err := s.rsvpsByItem()
 	if err != nil {
-		fmt.Println("Could not find timezone")
-		return "", nil
+		fmt.Printf("Error: %s\n", err)
 	}
-	yy, mm, dd := time.Now().In(loc).Add(time.Hour * 13).Date()
 
-	for _, c := range cards {
-		t := c.Due
+	for _, i := range items {
+		t := i.Due
 		if t != nil {
-			y, m, d := t.Date()
+			y, m, d := t.In(nz).Date()
 			if y == yy && m == mm && d == dd {
-				response.WriteString(c.Name)
+				response.WriteString(i.Title)
+				if r, ok := rsvps[i.ID]; ok && (len(r.Going) > 0 || len(r.Maybe) > 0) {
+					response.WriteString(" (" + r.attendees() + ")")
+				}
 				response.WriteString("\n")
 			}
 		}
@@ -200,7 +454,7 @@ func (s *server) addIdea(title string) (string, error) {
 	title = strings.TrimPrefix(title, "add")
 	title = strings.TrimSpace(title)
 
-	err := s.trello.CreateCard(&trello.Card{Name: title, IDList: ideasListID}, trello.Defaults())
+	err := s.backlog.Create(ideasList, &backlogItem{Title: title})
 	if err != nil {
 		return "", errors.Wrapf(err, "Could not create card with title: %s", title)
 	}
@@ -208,42 +462,87 @@ func (s *server) addIdea(title string) (string, error) {
 	return "easy, your idea is in there!", nil
 }
 
-type meetup struct {
-	Name       string
-	Local_date string
-}
-
-func (s *server) addMeetup(client *http.Client, url string) (string, error) {
-	url = strings.TrimPrefix(url, "<")
-	url = strings.TrimSuffix(url, ">")
-	apiURL := strings.Replace(url, "https://www.meetup.com", "http://api.meetup.com", -1)
+// scheduleIdea moves an idea to scheduled, eg. schedule go modules on 2018-10-02
+func (s *server) scheduleIdea(text string) (string, error) {
+	text = strings.TrimPrefix(text, "schedule")
+	on := strings.LastIndex(text, " on ")
+	if on == -1 || strings.TrimSpace(text[:on]) == "" {
+		return "tell me when, eg. schedule <talk title> on 2018-10-02", nil
+	}
+	title := strings.TrimSpace(text[:on])
+	date := strings.TrimSpace(text[on+4:])
 
-	resp, err := client.Get(apiURL)
+	due, err := time.ParseInLocation("2006-01-02", date, loadLocation("Pacific/Auckland"))
 	if err != nil {
-		return "", errors.Wrapf(err, "Could not make request to %s", apiURL)
+		return "I don't know when " + date + " is, try something like 2018-10-02", nil
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
+	ideas, err := s.backlog.Items(ideasList)
 	if err != nil {
-		return "", errors.Wrapf(err, "Could not read request for %s", apiURL)
+		return "", errors.Wrapf(err, "Could not get card titles for list: %s", ideasList)
 	}
 
-	var m meetup
-	e := json.Unmarshal(data, &m)
-	if e != nil {
-		fmt.Println("couldnt deserialize" + e.Error())
+	for _, i := range ideas {
+		if !strings.Contains(strings.ToLower(i.Title), title) {
+			continue
+		}
+		err = s.backlog.Move(i.ID, scheduledList)
+		if err != nil {
+			return "", errors.Wrapf(err, "Could not schedule: %s", i.Title)
+		}
+		err = s.backlog.SetDue(i.ID, &due)
+		if err != nil {
+			return "", errors.Wrapf(err, "Could not set a date for: %s", i.Title)
+		}
+		return i.Title + " is scheduled for " + due.Format("Mon 2 Jan"), nil
 	}
 
-	d, e := time.Parse("2006-01-02", m.Local_date)
-	if e != nil {
-		fmt.Println("error when parsing date: " + e.Error())
+	return "I couldn't find an idea called " + title, nil
+}
+
+func (s *server) addMeetups(client *http.Client, links []string, channel string) (string, error) {
+	var resp []string
+	for _, l := range links {
+		r, err := s.addMeetup(client, l, channel)
+		if err != nil {
+			return strings.Join(resp, "\n"), err
+		}
+		if r != "" {
+			resp = append(resp, r)
+		}
 	}
+	return strings.Join(resp, "\n"), nil
+}
 
-	err = s.trello.CreateCard(&trello.Card{Name: m.Name + " - " + url, IDList: meetupsListID, Due: &d}, trello.Defaults())
+func (s *server) addMeetup(client *http.Client, link string, channel string) (string, error) {
+	group, id, err := parseMeetupURL(link)
 	if err != nil {
-		return "", errors.Wrapf(err, "Could not create card for meetup: %s", url)
+		return "", err
 	}
 
-	return "looks like you just shared a meetup, I've added it to the trello board for you :)", nil
+	e, err := newMeetupClient(client).getEvent(group, id)
+	if err != nil {
+		return "", errors.Wrapf(err, "Could not get meetup: %s", link)
+	}
+	start, _ := e.start()
+
+	item := &backlogItem{Title: e.Name + " - " + e.Link, Description: e.description(), Due: &start}
+	return s.recordMeetup(item, e.Name, channel, "looks like you just shared a meetup, I've added it to the trello board for you :)")
+}
+
+// recordMeetup puts a meetup on the board and announces it in channel so people can say if they're going
+func (s *server) recordMeetup(item *backlogItem, name, channel, intro string) (string, error) {
+	err := s.backlog.Create(meetupsList, item)
+	if err != nil {
+		return "", errors.Wrapf(err, "Could not create card for meetup: %s", name)
+	}
+
+	resp := intro + "\nGoing to " + name + "? React with :" + goingReaction + ": if you are or :" + maybeReaction + ": if you might"
+	err = s.announceMeetup(channel, resp, *item, name)
+	if err != nil {
+		// still let them know it's on the board
+		fmt.Printf("Error: %s\n", err)
+		return resp, nil
+	}
+	return "", nil
 }
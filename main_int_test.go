@@ -1,6 +1,11 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -8,6 +13,7 @@ import (
 	"github.com/dhruv11/rudolph/mocks"
 	"github.com/nlopes/slack"
 	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -16,9 +22,11 @@ func TestAddInt(t *testing.T) {
 	trelloClient := new(mocks.TrelloClient)
 
 	srv := server{
-		trello: trelloClient,
-		slack:  rtm,
-		done:   make(chan struct{}),
+		backlog: &trelloBacklog{client: trelloClient},
+		trello:  trelloClient,
+		slack:   rtm,
+		store:   newStore(""),
+		done:    make(chan struct{}),
 	}
 
 	// Arrange
@@ -61,9 +69,11 @@ func TestHelpInt(t *testing.T) {
 	trelloClient := new(mocks.TrelloClient)
 
 	srv := server{
-		trello: trelloClient,
-		slack:  rtm,
-		done:   make(chan struct{}),
+		backlog: &trelloBacklog{client: trelloClient},
+		trello:  trelloClient,
+		slack:   rtm,
+		store:   newStore(""),
+		done:    make(chan struct{}),
 	}
 
 	// Arrange
@@ -76,7 +86,7 @@ func TestHelpInt(t *testing.T) {
 
 	// Expectations
 	rtm.On("NewOutgoingMessage", mock.MatchedBy(func(text string) bool {
-		return text == "I can help you with: \n Fetching ideas - @rudolph ideas \n Fetching scheduled talks - @rudolph scheduled \n Adding an idea: @rudolph add <talk title> \n Dad joke - @rudolph make me laugh \n Recognizing a HWR behaviour - @rudolph hwr <user handle> <2 letter behaviour initial> <message> \n\tEg. @rudolph hwr @ruskin.dantra CC It was awesome when you rapped for all of us \n Help - @rudolph help"
+		return text == "I can help you with: \n Fetching ideas - @rudolph ideas \n Fetching scheduled talks - @rudolph scheduled \n Adding an idea: @rudolph add <talk title> \n Scheduling a talk - @rudolph schedule <talk title> on <yyyy-mm-dd> \n Adding meetups - @rudolph <meetup.com, eventbrite, lu.ma or .ics link>, or share an .ics file with @rudolph \n Who's going to a meetup - @rudolph who's going to <meetup> \n Carpooling - @rudolph carpool offer 3 seats from <suburb> 8am, @rudolph carpool need ride from <suburb> tomorrow, @rudolph carpool home <suburb> \n Share prices - @rudolph price <symbol> <exchange>, @rudolph chart <symbol> <exchange> 1m \n Watching shares - @rudolph watch <symbol> <exchange>, @rudolph my watchlist, @rudolph watchlist times 9:30am 4pm \n Price alerts - @rudolph alert <symbol> <exchange> above 4.50, @rudolph my alerts, @rudolph cancel alert <number> \n Your portfolio - @rudolph portfolio add 100 <symbol> <exchange> @ 3.20, @rudolph portfolio \n Dad joke - @rudolph make me laugh \n Recognizing a HWR behaviour - @rudolph hwr <user handles> <2 letter behaviour initial> <message> \n\tEg. @rudolph hwr @ruskin.dantra CC It was awesome when you rapped for all of us \n\tAlso @rudolph hwr behaviours, hwr stats, hwr leaderboard and hwr export <user handle> since <yyyy-mm-dd> \n Waking someone up - @rudolph wake up <user handle> <why>, @rudolph snooze 30m, @rudolph unsnooze \n Not being DMed when people ask - @rudolph stop pinging me, @rudolph start pinging me \n Picking someone - @rudolph who's buying coffee, @rudolph who of <user handles> \n Taking turns - @rudolph rotation create <name> <user handles> weekly, @rudolph rotation next <name>, @rudolph rotations \n Async standups - @rudolph standup at 9:30am, @rudolph standup questions <question> | <question>, @rudolph standup now \n Help - @rudolph help"
 	}), mock.Anything).Return(nil)
 
 	trelloClient.On("GetList", mock.Anything, mock.Anything).Return(&trello.List{}, errors.New("throwing so we can skip this bit"))
@@ -101,9 +111,11 @@ func TestContributeInt(t *testing.T) {
 	trelloClient := new(mocks.TrelloClient)
 
 	srv := server{
-		trello: trelloClient,
-		slack:  rtm,
-		done:   make(chan struct{}),
+		backlog: &trelloBacklog{client: trelloClient},
+		trello:  trelloClient,
+		slack:   rtm,
+		store:   newStore(""),
+		done:    make(chan struct{}),
 	}
 
 	// Arrange
@@ -116,7 +128,7 @@ func TestContributeInt(t *testing.T) {
 
 	// Expectations
 	rtm.On("NewOutgoingMessage", mock.MatchedBy(func(text string) bool {
-		return text == "Sorry buddy, I don't know how to do that yet, why don't you contribute to my code base? \nhttps://github.com/dhruv11/rudolph\nI can help you with: \n Fetching ideas - @rudolph ideas \n Fetching scheduled talks - @rudolph scheduled \n Adding an idea: @rudolph add <talk title> \n Dad joke - @rudolph make me laugh \n Recognizing a HWR behaviour - @rudolph hwr <user handle> <2 letter behaviour initial> <message> \n\tEg. @rudolph hwr @ruskin.dantra CC It was awesome when you rapped for all of us \n Help - @rudolph help"
+		return text == "Sorry buddy, I don't know how to do that yet, why don't you contribute to my code base? \nhttps://github.com/dhruv11/rudolph\nI can help you with: \n Fetching ideas - @rudolph ideas \n Fetching scheduled talks - @rudolph scheduled \n Adding an idea: @rudolph add <talk title> \n Scheduling a talk - @rudolph schedule <talk title> on <yyyy-mm-dd> \n Adding meetups - @rudolph <meetup.com, eventbrite, lu.ma or .ics link>, or share an .ics file with @rudolph \n Who's going to a meetup - @rudolph who's going to <meetup> \n Carpooling - @rudolph carpool offer 3 seats from <suburb> 8am, @rudolph carpool need ride from <suburb> tomorrow, @rudolph carpool home <suburb> \n Share prices - @rudolph price <symbol> <exchange>, @rudolph chart <symbol> <exchange> 1m \n Watching shares - @rudolph watch <symbol> <exchange>, @rudolph my watchlist, @rudolph watchlist times 9:30am 4pm \n Price alerts - @rudolph alert <symbol> <exchange> above 4.50, @rudolph my alerts, @rudolph cancel alert <number> \n Your portfolio - @rudolph portfolio add 100 <symbol> <exchange> @ 3.20, @rudolph portfolio \n Dad joke - @rudolph make me laugh \n Recognizing a HWR behaviour - @rudolph hwr <user handles> <2 letter behaviour initial> <message> \n\tEg. @rudolph hwr @ruskin.dantra CC It was awesome when you rapped for all of us \n\tAlso @rudolph hwr behaviours, hwr stats, hwr leaderboard and hwr export <user handle> since <yyyy-mm-dd> \n Waking someone up - @rudolph wake up <user handle> <why>, @rudolph snooze 30m, @rudolph unsnooze \n Not being DMed when people ask - @rudolph stop pinging me, @rudolph start pinging me \n Picking someone - @rudolph who's buying coffee, @rudolph who of <user handles> \n Taking turns - @rudolph rotation create <name> <user handles> weekly, @rudolph rotation next <name>, @rudolph rotations \n Async standups - @rudolph standup at 9:30am, @rudolph standup questions <question> | <question>, @rudolph standup now \n Help - @rudolph help"
 	}), mock.Anything).Return(nil)
 
 	trelloClient.On("GetList", mock.Anything, mock.Anything).Return(&trello.List{}, errors.New("throwing so we can skip this bit"))
@@ -135,3 +147,96 @@ func TestContributeInt(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 	rtm.AssertExpectations(t)
 }
+
+func TestTrelloWebhookInt(t *testing.T) {
+	rtm := new(mocks.SlackRTMInterface)
+
+	srv := server{
+		slack: rtm,
+		webhook: webhookConfig{
+			secret:      "secret",
+			callbackURL: "https://rudolph.example/trello",
+		},
+		done: make(chan struct{}),
+	}
+
+	// Arrange
+	body := `{"action":{"type":"updateCard","data":{"card":{"name":"Go talk","closed":true},"list":{"id":"` + scheduledListID + `"},"old":{"closed":false}}}}`
+	mac := hmac.New(sha1.New, []byte("secret"))
+	mac.Write([]byte(body + "https://rudolph.example/trello"))
+
+	rtm.On("SendMessage", mock.Anything)
+
+	// Expectations
+	rtm.On("NewOutgoingMessage", "Go talk has been archived", teamChannelID).Return(nil)
+
+	req := httptest.NewRequest("POST", "/trello", strings.NewReader(body))
+	req.Header.Set("X-Trello-Webhook", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	srv.handleTrelloWebhook(w, req)
+
+	forged := httptest.NewRequest("POST", "/trello", strings.NewReader(body))
+	forged.Header.Set("X-Trello-Webhook", "forged")
+	fw := httptest.NewRecorder()
+	srv.handleTrelloWebhook(fw, forged)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 401, fw.Code)
+	rtm.AssertExpectations(t)
+	rtm.AssertNumberOfCalls(t, "SendMessage", 1)
+}
+
+func TestOfferMeetupInt(t *testing.T) {
+	rtm := new(mocks.SlackRTMInterface)
+	trelloClient := new(mocks.TrelloClient)
+
+	srv := server{
+		backlog: &trelloBacklog{client: trelloClient},
+		trello:  trelloClient,
+		slack:   rtm,
+		store:   newStore(""),
+		done:    make(chan struct{}),
+	}
+
+	// Arrange
+	incoming := make(chan slack.RTMEvent)
+	rtm.On("GetIncomingEvents").Return(incoming)
+
+	info := &slack.Info{User: &slack.UserDetails{ID: "rudolph"}}
+	rtm.On("GetInfo").Return(info)
+
+	trelloClient.On("GetList", mock.Anything, mock.Anything).Return(&trello.List{}, errors.New("throwing so we can skip this bit"))
+
+	// Expectations
+	rtm.On("PostMessage", "C1", mock.MatchedBy(func(text string) bool {
+		return strings.HasPrefix(text, "Looks like you shared a meetup: https://www.meetup.com/golang-nz/events/254375678/")
+	}), mock.Anything).Return("C1", "1537142400.000100", nil).Once()
+	rtm.On("AddReaction", confirmReaction, slack.NewRefToMessage("C1", "1537142400.000100")).Return(nil).Once()
+
+	srv.start()
+
+	msg := &slack.MessageEvent{}
+	msg.User = "kal"
+	msg.Channel = "C1"
+	msg.Timestamp = "1537142300.000100"
+	msg.Text = "anyone going to <https://www.meetup.com/golang-nz/events/254375678/>?"
+	incoming <- slack.RTMEvent{Type: slack.TYPE_MESSAGE, Data: msg}
+
+	// slack unfurls the same link, we've already asked about it
+	unfurl := &slack.MessageEvent{}
+	unfurl.Channel = "C1"
+	unfurl.SubType = "message_changed"
+	unfurl.SubMessage = &slack.Msg{
+		User:        "kal",
+		Timestamp:   "1537142300.000100",
+		Text:        msg.Text,
+		Attachments: []slack.Attachment{{TitleLink: "https://www.meetup.com/golang-nz/events/254375678/"}},
+	}
+	incoming <- slack.RTMEvent{Type: slack.TYPE_MESSAGE, Data: unfurl}
+
+	srv.stop()
+
+	time.Sleep(100 * time.Millisecond)
+	rtm.AssertExpectations(t)
+	rtm.AssertNotCalled(t, "SendMessage", mock.Anything)
+}
@@ -2,17 +2,30 @@ package main
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"image/png"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/adlio/trello"
+	"github.com/dhruv11/rudolph/mocks"
+	"github.com/nlopes/slack"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestGetHelp(t *testing.T) {
-	expected := "I can help you with: \n Fetching ideas - @rudolph ideas \n Fetching scheduled talks - @rudolph scheduled \n Adding an idea: @rudolph add <talk title> \n Dad joke - @rudolph make me laugh \n Recognizing a HWR behaviour - @rudolph hwr <user handle> <2 letter behaviour initial> <message> \n\tEg. @rudolph hwr @ruskin.dantra CC It was awesome when you rapped for all of us \n Help - @rudolph help"
+	expected := "I can help you with: \n Fetching ideas - @rudolph ideas \n Fetching scheduled talks - @rudolph scheduled \n Adding an idea: @rudolph add <talk title> \n Scheduling a talk - @rudolph schedule <talk title> on <yyyy-mm-dd> \n Adding meetups - @rudolph <meetup.com, eventbrite, lu.ma or .ics link>, or share an .ics file with @rudolph \n Who's going to a meetup - @rudolph who's going to <meetup> \n Carpooling - @rudolph carpool offer 3 seats from <suburb> 8am, @rudolph carpool need ride from <suburb> tomorrow, @rudolph carpool home <suburb> \n Share prices - @rudolph price <symbol> <exchange>, @rudolph chart <symbol> <exchange> 1m \n Watching shares - @rudolph watch <symbol> <exchange>, @rudolph my watchlist, @rudolph watchlist times 9:30am 4pm \n Price alerts - @rudolph alert <symbol> <exchange> above 4.50, @rudolph my alerts, @rudolph cancel alert <number> \n Your portfolio - @rudolph portfolio add 100 <symbol> <exchange> @ 3.20, @rudolph portfolio \n Dad joke - @rudolph make me laugh \n Recognizing a HWR behaviour - @rudolph hwr <user handles> <2 letter behaviour initial> <message> \n\tEg. @rudolph hwr @ruskin.dantra CC It was awesome when you rapped for all of us \n\tAlso @rudolph hwr behaviours, hwr stats, hwr leaderboard and hwr export <user handle> since <yyyy-mm-dd> \n Waking someone up - @rudolph wake up <user handle> <why>, @rudolph snooze 30m, @rudolph unsnooze \n Not being DMed when people ask - @rudolph stop pinging me, @rudolph start pinging me \n Picking someone - @rudolph who's buying coffee, @rudolph who of <user handles> \n Taking turns - @rudolph rotation create <name> <user handles> weekly, @rudolph rotation next <name>, @rudolph rotations \n Async standups - @rudolph standup at 9:30am, @rudolph standup questions <question> | <question>, @rudolph standup now \n Help - @rudolph help"
 
 	actual := getHelp()
 	if actual != expected {
@@ -21,7 +34,7 @@ func TestGetHelp(t *testing.T) {
 }
 
 func TestGetContribute(t *testing.T) {
-	expected := "Sorry buddy, I don't know how to do that yet, why don't you contribute to my code base? \nhttps://github.com/dhruv11/rudolph\nI can help you with: \n Fetching ideas - @rudolph ideas \n Fetching scheduled talks - @rudolph scheduled \n Adding an idea: @rudolph add <talk title> \n Dad joke - @rudolph make me laugh \n Recognizing a HWR behaviour - @rudolph hwr <user handle> <2 letter behaviour initial> <message> \n\tEg. @rudolph hwr @ruskin.dantra CC It was awesome when you rapped for all of us \n Help - @rudolph help"
+	expected := "Sorry buddy, I don't know how to do that yet, why don't you contribute to my code base? \nhttps://github.com/dhruv11/rudolph\nI can help you with: \n Fetching ideas - @rudolph ideas \n Fetching scheduled talks - @rudolph scheduled \n Adding an idea: @rudolph add <talk title> \n Scheduling a talk - @rudolph schedule <talk title> on <yyyy-mm-dd> \n Adding meetups - @rudolph <meetup.com, eventbrite, lu.ma or .ics link>, or share an .ics file with @rudolph \n Who's going to a meetup - @rudolph who's going to <meetup> \n Carpooling - @rudolph carpool offer 3 seats from <suburb> 8am, @rudolph carpool need ride from <suburb> tomorrow, @rudolph carpool home <suburb> \n Share prices - @rudolph price <symbol> <exchange>, @rudolph chart <symbol> <exchange> 1m \n Watching shares - @rudolph watch <symbol> <exchange>, @rudolph my watchlist, @rudolph watchlist times 9:30am 4pm \n Price alerts - @rudolph alert <symbol> <exchange> above 4.50, @rudolph my alerts, @rudolph cancel alert <number> \n Your portfolio - @rudolph portfolio add 100 <symbol> <exchange> @ 3.20, @rudolph portfolio \n Dad joke - @rudolph make me laugh \n Recognizing a HWR behaviour - @rudolph hwr <user handles> <2 letter behaviour initial> <message> \n\tEg. @rudolph hwr @ruskin.dantra CC It was awesome when you rapped for all of us \n\tAlso @rudolph hwr behaviours, hwr stats, hwr leaderboard and hwr export <user handle> since <yyyy-mm-dd> \n Waking someone up - @rudolph wake up <user handle> <why>, @rudolph snooze 30m, @rudolph unsnooze \n Not being DMed when people ask - @rudolph stop pinging me, @rudolph start pinging me \n Picking someone - @rudolph who's buying coffee, @rudolph who of <user handles> \n Taking turns - @rudolph rotation create <name> <user handles> weekly, @rudolph rotation next <name>, @rudolph rotations \n Async standups - @rudolph standup at 9:30am, @rudolph standup questions <question> | <question>, @rudolph standup now \n Help - @rudolph help"
 
 	actual := getContribute()
 	if actual != expected {
@@ -78,24 +91,38 @@ func TestGetDadJokeUnhappy(t *testing.T) {
 	}
 }
 
-func TestGetSharePrice(t *testing.T) {
-	expected := "atm nzx: $11.99"
-
-	f := func(req *http.Request) (*http.Response, error) {
-		if req.URL.String() == "https://www.google.co.nz/search?q=atm+nzx" {
-			return &http.Response{
-				StatusCode: 200,
-				Body:       ioutil.NopCloser(bytes.NewBufferString(`<span style="font-size:157%"><b>11.99</b>`)),
-			}, nil
-		}
-		return nil, errors.New("unexpected request")
+func yahooResponse(req *http.Request) (*http.Response, error) {
+	switch req.URL.String() {
+	case "https://query1.finance.yahoo.com/v8/finance/chart/ATM.NZ?range=1d&interval=1d",
+		"https://query1.finance.yahoo.com/v8/finance/chart/XRO.AX?range=1d&interval=1d":
+		return &http.Response{
+			StatusCode: 200,
+			Body: ioutil.NopCloser(bytes.NewBufferString(`{"chart":{"result":[{"meta":{"currency":"NZD","exchangeName":"NZE",
+				"regularMarketPrice":11.99,"chartPreviousClose":11.8,"regularMarketTime":1537142400}}],"error":null}}`)),
+		}, nil
+	case "https://query1.finance.yahoo.com/v8/finance/chart/ATM.NZ?range=1mo&interval=1d":
+		return &http.Response{
+			StatusCode: 200,
+			Body: ioutil.NopCloser(bytes.NewBufferString(`{"chart":{"result":[{"meta":{"currency":"NZD"},
+				"timestamp":[1536897600,1537142400,1537228800,1537315200],
+				"indicators":{"quote":[{"close":[3.9,null,4.05,4.2]}]}}],"error":null}}`)),
+		}, nil
+	case "https://query1.finance.yahoo.com/v8/finance/chart/NOPE.NZ?range=1d&interval=1d",
+		"https://query1.finance.yahoo.com/v8/finance/chart/NOPE.NZ?range=1mo&interval=1d":
+		return &http.Response{
+			StatusCode: 404,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"chart":{"result":null,"error":{"code":"Not Found","description":"No data found, symbol may be delisted"}}}`)),
+		}, nil
 	}
+	return nil, errors.New("unexpected request")
+}
 
-	client := &http.Client{
-		Transport: RoundTripFunc(f),
-	}
+func TestGetSharePrice(t *testing.T) {
+	expected := "ATM (NZX): $11.99 NZD +0.19 (+1.61%)"
 
-	actual, err := getSharePrice(client, "atm nzx")
+	quotes := newYahooQuotes(&http.Client{Transport: RoundTripFunc(yahooResponse)})
+
+	actual, err := getSharePrice(quotes, "atm nzx")
 
 	if err != nil {
 		t.Errorf(err.Error())
@@ -103,27 +130,211 @@ func TestGetSharePrice(t *testing.T) {
 	if actual != expected {
 		t.Errorf("share price is incorrect, got: %s, want: %s.", actual, expected)
 	}
+
+	q, err := quotes.Quote("atm nzx")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2018, 9, 17, 0, 0, 0, 0, time.UTC), q.Time.UTC())
+
+	_, err = quotes.Quote("nope nzx")
+	assert.True(t, isSymbolNotFound(err))
+	actual, err = getSharePrice(quotes, "price nope nzx")
+	assert.NoError(t, err)
+	assert.Equal(t, "I couldn't find a share called nope nzx, try something like price atm nzx", actual)
+
+	_, err = quotes.Quote("atm lse")
+	assert.EqualError(t, err, "I don't know the lse exchange")
+	actual, err = getSharePrice(quotes, "price atm lse")
+	assert.NoError(t, err)
+	assert.Equal(t, "I don't know the lse exchange, try something like price atm nzx", actual)
+	actual, err = getSharePrice(quotes, "price atm nzx now")
+	assert.NoError(t, err)
+	assert.Equal(t, "Not a share symbol: atm nzx now, try something like price atm nzx", actual)
 }
 
-func TestGetScheduledUpdate(t *testing.T) {
-	expected := "atm nzx: $11.99\nxro asx: $11.99\n"
+func TestFixtureQuotes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quotes")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "quotes.json")
+	err = ioutil.WriteFile(path, []byte(`{"ATM NZX": {"price": 11.99, "currency": "NZD", "change": -0.1, "percent_change": -0.83}}`), 0644)
+	assert.NoError(t, err)
 
-	f := func(req *http.Request) (*http.Response, error) {
-		if req.URL.String() == "https://www.google.co.nz/search?q=atm+nzx" ||
-			req.URL.String() == "https://www.google.co.nz/search?q=xro+asx" {
-			return &http.Response{
-				StatusCode: 200,
-				Body:       ioutil.NopCloser(bytes.NewBufferString(`<span style="font-size:157%"><b>11.99</b>`)),
-			}, nil
-		}
-		return nil, errors.New("unexpected request")
+	quotes, err := newQuoteProvider(sharesConfig{Provider: "fixture", Fixtures: path}, nil)
+	assert.NoError(t, err)
+
+	actual, err := getSharePrice(quotes, "price atm nzx")
+	assert.NoError(t, err)
+	assert.Equal(t, "ATM (NZX): $11.99 NZD -0.10 (-0.83%)", actual)
+
+	_, err = quotes.Quote("xro asx")
+	assert.True(t, isSymbolNotFound(err))
+}
+
+// testQuotes - quotes we can change between checks
+type testQuotes map[string]quote
+
+func (t testQuotes) Quote(symbol string) (quote, error) {
+	if _, _, err := parseSymbol(symbol); err != nil {
+		return quote{}, err
+	}
+	q, ok := t[symbol]
+	if !ok {
+		return q, symbolNotFoundError{symbol: symbol}
 	}
+	return q, nil
+}
 
-	client := &http.Client{
-		Transport: RoundTripFunc(f),
+func (t testQuotes) History(symbol, period string) ([]pricePoint, error) {
+	return nil, nil
+}
+
+// onSendMessage mocks sending slack messages, calling sent with each one
+func onSendMessage(rtm *mocks.SlackRTMInterface, sent func(channel, text string)) {
+	rtm.On("NewOutgoingMessage", mock.Anything, mock.Anything).Return(func(text, channel string, options ...slack.RTMsgOption) *slack.OutgoingMessage {
+		return &slack.OutgoingMessage{Text: text, Channel: channel}
+	})
+	rtm.On("SendMessage", mock.Anything).Run(func(args mock.Arguments) {
+		m := args.Get(0).(*slack.OutgoingMessage)
+		sent(m.Channel, m.Text)
+	})
+}
+
+func TestAlerts(t *testing.T) {
+	var sent []string
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("OpenIMChannel", "U1").Return(false, false, "D1", nil)
+	onSendMessage(rtm, func(channel, text string) { sent = append(sent, text) })
+
+	quotes := testQuotes{"atm nzx": {Symbol: "ATM", Exchange: "NZX", Currency: "NZD", Price: 4.40}}
+	srv := server{slack: rtm, store: newStore(""), quotes: quotes}
+	now := time.Date(2018, 9, 17, 0, 0, 0, 0, time.UTC)
+
+	resp, err := srv.alert("U1", "alert atm nzx above $4.50")
+	assert.NoError(t, err)
+	assert.Equal(t, "I'll let you know when atm nzx goes above $4.50", resp)
+	resp, err = srv.alert("U1", "alert atm nzx move 5%")
+	assert.NoError(t, err)
+	assert.Equal(t, "I'll let you know when atm nzx moves 5% in a day", resp)
+	resp, err = srv.alert("U1", "alert nope nzx below 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "I couldn't find a share called nope nzx, try something like alert atm nzx above 4.50", resp)
+	resp, err = srv.alert("U1", "alert atm lse above 5")
+	assert.NoError(t, err)
+	assert.Equal(t, "I don't know the lse exchange, try something like alert atm nzx above 4.50", resp)
+	resp, err = srv.alert("U1", "alert atm nzx sideways")
+	assert.NoError(t, err)
+	assert.Equal(t, "Try something like alert atm nzx above 4.50 or alert xro asx move 5%", resp)
+
+	assert.NoError(t, srv.checkAlerts(now))
+	assert.Empty(t, sent)
+
+	// fires once, even though it stays above
+	quotes["atm nzx"] = quote{Symbol: "ATM", Exchange: "NZX", Currency: "NZD", Price: 4.51}
+	assert.NoError(t, srv.checkAlerts(now))
+	quotes["atm nzx"] = quote{Symbol: "ATM", Exchange: "NZX", Currency: "NZD", Price: 4.49}
+	assert.NoError(t, srv.checkAlerts(now))
+	quotes["atm nzx"] = quote{Symbol: "ATM", Exchange: "NZX", Currency: "NZD", Price: 4.50}
+	assert.NoError(t, srv.checkAlerts(now))
+	assert.Equal(t, []string{":rotating_light: ATM (NZX): $4.51 NZD +0.00 (+0.00%), you wanted to know when atm nzx goes above $4.50"}, sent)
+
+	// until it drops back far enough
+	quotes["atm nzx"] = quote{Symbol: "ATM", Exchange: "NZX", Currency: "NZD", Price: 4.40, Change: -0.25, PercentChange: -5.4}
+	assert.NoError(t, srv.checkAlerts(now))
+	quotes["atm nzx"] = quote{Symbol: "ATM", Exchange: "NZX", Currency: "NZD", Price: 4.60, Change: -0.05, PercentChange: -1.1}
+	assert.NoError(t, srv.checkAlerts(now))
+	assert.Len(t, sent, 3)
+	assert.Equal(t, ":rotating_light: ATM (NZX): $4.40 NZD -0.25 (-5.40%), you wanted to know when atm nzx moves 5% in a day", sent[1])
+
+	resp, err = srv.alert("U1", "alerts")
+	assert.NoError(t, err)
+	assert.Equal(t, "Your alerts:\n1. atm nzx goes above $4.50 (fired Mon 17 Sep 12:00pm)\n2. atm nzx moves 5% in a day\nCancel one with cancel alert <number>", resp)
+	resp, err = srv.alert("U1", "cancel alert 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "I won't tell you when atm nzx goes above $4.50 any more", resp)
+	resp, err = srv.alert("U1", "cancel alert 2")
+	assert.NoError(t, err)
+	assert.Equal(t, "You don't have an alert 2, see your alerts with alerts", resp)
+}
+
+func TestChart(t *testing.T) {
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("UploadFile", mock.MatchedBy(func(p slack.FileUploadParameters) bool {
+		img, err := png.Decode(p.Reader)
+		return err == nil && img.Bounds().Dx() == 600 && p.Filename == "atm-nzx-1m.png" &&
+			p.InitialComment == "atm nzx over 1m: $3.90 to $4.20 (+7.69%)" && p.Channels[0] == "C1"
+	})).Return(&slack.File{}, nil).Once()
+	rtm.On("UploadFile", mock.Anything).Return(nil, errors.New("missing_scope")).Once()
+
+	srv := server{slack: rtm, quotes: newYahooQuotes(&http.Client{Transport: RoundTripFunc(yahooResponse)})}
+
+	resp, err := srv.chart("C1", "chart atm nzx")
+	assert.NoError(t, err)
+	assert.Equal(t, "", resp)
+
+	resp, err = srv.chart("C1", "chart atm nzx 1m")
+	assert.NoError(t, err)
+	assert.Equal(t, "atm nzx over 1m: $3.90 to $4.20 (+7.69%)\n▁▄█", resp)
+
+	resp, err = srv.chart("C1", "chart nope nzx")
+	assert.NoError(t, err)
+	assert.Equal(t, "I couldn't find a share called nope nzx, try something like chart atm nzx 1m", resp)
+	resp, err = srv.chart("C1", "chart atm lse")
+	assert.NoError(t, err)
+	assert.Equal(t, "I don't know the lse exchange, try something like chart atm nzx 1m", resp)
+	rtm.AssertExpectations(t)
+}
+
+func TestPortfolio(t *testing.T) {
+	quotes := testQuotes{
+		"atm nzx":  {Symbol: "ATM", Exchange: "NZX", Currency: "NZD", Price: 4.00, Change: 0.10},
+		"xro asx":  {Symbol: "XRO", Exchange: "ASX", Currency: "AUD", Price: 50.00, Change: -1.00},
+		"audnzd=x": {Price: 1.10},
+		"nzdaud=x": {Price: 0.90},
 	}
+	srv := server{store: newStore(""), quotes: quotes}
+
+	resp, err := srv.portfolio("U1", "portfolio")
+	assert.NoError(t, err)
+	assert.Equal(t, "Your portfolio is empty, try portfolio add 100 atm nzx @ 3.20", resp)
+
+	resp, err = srv.portfolio("U1", "portfolio add 100 atm nzx @ 3.20")
+	assert.NoError(t, err)
+	assert.Equal(t, "You've got 100 atm nzx at an average of $3.20 NZD", resp)
+	resp, err = srv.portfolio("U1", "portfolio add 100 atm nzx @ 4.80")
+	assert.NoError(t, err)
+	assert.Equal(t, "You've got 200 atm nzx at an average of $4.00 NZD", resp)
+	srv.portfolio("U1", "portfolio add 10 xro asx @ 40")
+	resp, err = srv.portfolio("U1", "portfolio add 10 nope nzx @ 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "I couldn't find a share called nope nzx, try something like portfolio add 100 atm nzx @ 3.20", resp)
+	resp, err = srv.portfolio("U1", "portfolio add 10 atm lse @ 1")
+	assert.NoError(t, err)
+	assert.Equal(t, "I don't know the lse exchange, try something like portfolio add 100 atm nzx @ 3.20", resp)
+
+	resp, err = srv.portfolio("U1", "portfolio")
+	assert.NoError(t, err)
+	assert.Equal(t, "atm nzx: 200 @ $4.00, now $4.00 = $800.00 NZD, today +20.00, total +0.00 (+0.00%)\n"+
+		"xro asx: 10 @ $40.00, now $50.00 = $500.00 AUD, today -10.00, total +100.00 (+25.00%)\n"+
+		"Total: $1350.00 NZD, today +9.00, total +110.00 (+8.87%)", resp)
+
+	resp, err = srv.portfolio("U1", "portfolio aud")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(resp, "Total: $1220.00 AUD, today +8.00, total +100.00 (+8.93%)"), resp)
+
+	resp, err = srv.portfolio("U1", "portfolio remove xro asx")
+	assert.NoError(t, err)
+	assert.Equal(t, "I've taken xro asx out of your portfolio", resp)
+	resp, err = srv.portfolio("U2", "portfolio remove xro asx")
+	assert.NoError(t, err)
+	assert.Equal(t, "You don't have any xro asx", resp)
+}
+
+func TestGetScheduledUpdate(t *testing.T) {
+	expected := "ATM (NZX): $11.99 NZD +0.19 (+1.61%)\nXRO (ASX): $11.99 NZD +0.19 (+1.61%)\n"
 
-	actual, err := getScheduledUpdate(client)
+	quotes := newYahooQuotes(&http.Client{Transport: RoundTripFunc(yahooResponse)})
+
+	actual, err := getScheduledUpdate(quotes, []string{"atm nzx", "xro asx"})
 
 	if err != nil {
 		t.Errorf(err.Error())
@@ -140,32 +351,1602 @@ type mockClock struct {
 func (c mockClock) Now() time.Time                                { return c.t }
 func (c mockClock) LoadLocation(l string) (*time.Location, error) { return time.LoadLocation(l) }
 
-func TestShouldSendUpdate(t *testing.T) {
+func TestSharesDue(t *testing.T) {
+	both := []string{"atm nzx", "xro asx"}
+
 	tests := map[string]struct {
-		input  time.Time
-		output bool
+		input     time.Time
+		watchlist *watchlist
+		output    []string
 	}{
-		"weekday - trading hours": {
-			input:  time.Date(2018, 9, 17, 0, 30, 0, 0, time.UTC),
-			output: true,
+		"nzx opens": {
+			input:     time.Date(2018, 9, 16, 22, 0, 0, 0, time.UTC),
+			watchlist: &watchlist{Symbols: both},
+			output:    []string{"atm nzx"},
 		},
-		"weekday - after trading hours": {
-			input:  time.Date(2018, 9, 17, 14, 30, 0, 0, time.UTC),
-			output: false,
+		"asx opens": {
+			input:     time.Date(2018, 9, 17, 0, 0, 0, 0, time.UTC),
+			watchlist: &watchlist{Symbols: both},
+			output:    []string{"xro asx"},
+		},
+		"nzx closes": {
+			input:     time.Date(2018, 9, 17, 4, 45, 0, 0, time.UTC),
+			watchlist: &watchlist{Symbols: both},
+			output:    []string{"atm nzx"},
+		},
+		"trading hours": {
+			input:     time.Date(2018, 9, 17, 0, 30, 0, 0, time.UTC),
+			watchlist: &watchlist{Symbols: both},
+			output:    nil,
 		},
 		"weekend": {
-			input:  time.Date(2018, 9, 15, 0, 30, 0, 0, time.UTC),
-			output: false,
+			input:     time.Date(2018, 9, 15, 22, 0, 0, 0, time.UTC),
+			watchlist: &watchlist{Symbols: both},
+			output:    nil,
+		},
+		"nzx opens after daylight saving": {
+			input:     time.Date(2018, 9, 30, 21, 0, 0, 0, time.UTC),
+			watchlist: &watchlist{Symbols: both},
+			output:    []string{"atm nzx"},
+		},
+		"labour day in nz": {
+			input:     time.Date(2018, 10, 21, 21, 0, 0, 0, time.UTC),
+			watchlist: &watchlist{Symbols: both},
+			output:    nil,
+		},
+		"good friday": {
+			input:     time.Date(2019, 4, 19, 0, 0, 0, 0, time.UTC),
+			watchlist: &watchlist{Symbols: both},
+			output:    nil,
+		},
+		"their own time and timezone on labour day in nz": {
+			input:     time.Date(2018, 10, 22, 1, 30, 0, 0, time.UTC),
+			watchlist: &watchlist{Symbols: both, Times: []string{"12:30"}, Timezone: "Australia/Sydney"},
+			output:    []string{"xro asx"},
+		},
+		"no calendar for the exchange": {
+			input:     time.Date(2018, 10, 22, 1, 30, 0, 0, time.UTC),
+			watchlist: &watchlist{Symbols: []string{"aapl"}, Times: []string{"12:30"}, Timezone: "Australia/Sydney"},
+			output:    []string{"aapl"},
 		},
 	}
 
 	for testName, test := range tests {
 		t.Logf("Running test case %s", testName)
-		output := shouldSendUpdate(mockClock{t: test.input})
+		output := sharesDue(mockClock{t: test.input}, test.watchlist)
 		assert.Equal(t, test.output, output)
 	}
 }
 
+func TestExchangeCalendars(t *testing.T) {
+	assert.Equal(t, date(2018, time.April, 1), easterSunday(2018))
+	assert.Equal(t, date(2019, time.April, 21), easterSunday(2019))
+	assert.Equal(t, date(2024, time.March, 31), easterSunday(2024))
+
+	nzx, asx := exchanges["NZX"], exchanges["ASX"]
+	noon := func(y int, m time.Month, d int, e *exchange) time.Time {
+		return time.Date(y, m, d, 12, 0, 0, 0, e.location())
+	}
+
+	// anzac day on a saturday moves to monday in nz but not australia
+	assert.False(t, nzx.tradingDay(noon(2020, time.April, 27, nzx)))
+	assert.True(t, asx.tradingDay(noon(2020, time.April, 27, asx)))
+	// christmas on a saturday
+	assert.False(t, nzx.tradingDay(noon(2021, time.December, 27, nzx)))
+	assert.False(t, nzx.tradingDay(noon(2021, time.December, 28, nzx)))
+	assert.True(t, nzx.tradingDay(noon(2021, time.December, 29, nzx)))
+	// matariki and king's birthday
+	assert.False(t, nzx.tradingDay(noon(2024, time.June, 28, nzx)))
+	assert.False(t, asx.tradingDay(noon(2024, time.June, 10, asx)))
+	assert.True(t, nzx.tradingDay(noon(2024, time.June, 10, nzx)))
+
+	assert.True(t, nzx.isOpen(time.Date(2018, 9, 17, 10, 0, 0, 0, nzx.location())))
+	assert.False(t, nzx.isOpen(time.Date(2018, 9, 17, 16, 45, 0, 0, nzx.location())))
+}
+
+func TestWatchlist(t *testing.T) {
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("OpenIMChannel", "U1").Return(false, false, "D1", nil)
+	rtm.On("NewOutgoingMessage", "ATM (NZX): $11.99 NZD +0.19 (+1.61%)\nXRO (ASX): $11.99 NZD +0.19 (+1.61%)\n", "D1").Return(&slack.OutgoingMessage{}).Once()
+	rtm.On("SendMessage", mock.Anything).Once()
+
+	srv := server{
+		slack:  rtm,
+		store:  newStore(""),
+		quotes: newYahooQuotes(&http.Client{Transport: RoundTripFunc(yahooResponse)}),
+	}
+
+	resp, err := srv.watch("U1", "watch atm nzx")
+	assert.NoError(t, err)
+	assert.Equal(t, "I'll keep you posted on ATM (NZX): $11.99 NZD +0.19 (+1.61%)", resp)
+	resp, err = srv.watch("U1", "watch nope nzx")
+	assert.NoError(t, err)
+	assert.Equal(t, "I couldn't find a share called nope nzx, try something like watch atm nzx", resp)
+	resp, err = srv.watch("U1", "watch atm lse")
+	assert.NoError(t, err)
+	assert.Equal(t, "I don't know the lse exchange, try something like watch atm nzx", resp)
+	srv.watch("U1", "watch xro asx")
+	srv.watch("U2", "watch atm nzx")
+
+	resp, err = srv.unwatch("U2", "unwatch atm nzx")
+	assert.NoError(t, err)
+	assert.Equal(t, "No more updates on atm nzx for you", resp)
+	resp, err = srv.unwatch("U2", "unwatch atm nzx")
+	assert.NoError(t, err)
+	assert.Equal(t, "You weren't watching atm nzx", resp)
+
+	resp, err = srv.watchlistCommand("U1", "watchlist times 9am 4:15pm")
+	assert.NoError(t, err)
+	assert.Equal(t, "You'll get updates at 09:00, 16:15", resp)
+	resp, err = srv.watchlistCommand("U1", "watchlist timezone Australia/Sydney")
+	assert.NoError(t, err)
+	assert.Equal(t, "You'll get updates in Australia/Sydney time", resp)
+	resp, err = srv.watchlistCommand("U1", "watchlist times 25pm")
+	assert.NoError(t, err)
+	assert.Equal(t, "I don't know what time 25pm is, try something like open, close, 9:30am or 16:00", resp)
+
+	resp, err = srv.watchlistCommand("U1", "My watchlist")
+	assert.NoError(t, err)
+	assert.Equal(t, "ATM (NZX): $11.99 NZD +0.19 (+1.61%)\nXRO (ASX): $11.99 NZD +0.19 (+1.61%)\nUpdates at 09:00, 16:15 Australia/Sydney on trading days", resp)
+
+	// 9am monday in sydney, U2 isn't watching anything
+	assert.NoError(t, srv.sendWatchlistUpdates(mockClock{t: time.Date(2018, 9, 16, 23, 0, 0, 0, time.UTC)}))
+	assert.NoError(t, srv.sendWatchlistUpdates(mockClock{t: time.Date(2018, 9, 17, 0, 0, 0, 0, time.UTC)}))
+	rtm.AssertExpectations(t)
+
+	// no DM at all when yahoo is down
+	down := func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}
+	srv.quotes = newYahooQuotes(&http.Client{Transport: RoundTripFunc(down)})
+	assert.NoError(t, srv.sendWatchlistUpdates(mockClock{t: time.Date(2018, 9, 16, 23, 0, 0, 0, time.UTC)}))
+	rtm.AssertExpectations(t)
+}
+
+func TestVerifyTrelloSignature(t *testing.T) {
+	body := []byte(`{"action":{}}`)
+	// base64(HMAC-SHA1("secret", body + callback))
+	mac := hmac.New(sha1.New, []byte("secret"))
+	mac.Write(body)
+	mac.Write([]byte("https://rudolph.example/trello"))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	assert.True(t, verifyTrelloSignature(body, "https://rudolph.example/trello", "secret", signature))
+	assert.False(t, verifyTrelloSignature(body, "https://rudolph.example/trello", "wrong", signature))
+	assert.False(t, verifyTrelloSignature([]byte(`{}`), "https://rudolph.example/trello", "secret", signature))
+	assert.False(t, verifyTrelloSignature(body, "https://rudolph.example/trello", "", ""))
+}
+
+func TestAnnouncement(t *testing.T) {
+	due := time.Date(2018, 9, 17, 3, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		input  string
+		output string
+	}{
+		"card created in scheduled": {
+			input:  `{"type":"createCard","data":{"card":{"name":"Go talk","due":"2018-09-17T03:00:00Z"},"list":{"id":"` + scheduledListID + `"}}}`,
+			output: "New talk scheduled: Go talk on " + formatDue(due),
+		},
+		"card created in ideas": {
+			input:  `{"type":"createCard","data":{"card":{"name":"Go talk"},"list":{"id":"` + ideasListID + `"}}}`,
+			output: "",
+		},
+		"card moved to scheduled": {
+			input:  `{"type":"updateCard","data":{"card":{"name":"Go talk"},"listAfter":{"id":"` + scheduledListID + `"},"old":{"idList":"x"}}}`,
+			output: "New talk scheduled: Go talk",
+		},
+		"due date changed": {
+			input:  `{"type":"updateCard","data":{"card":{"name":"Go talk","due":"2018-09-17T03:00:00Z"},"list":{"id":"` + scheduledListID + `"},"old":{"due":null}}}`,
+			output: "Go talk has moved to " + formatDue(due),
+		},
+		"due date removed": {
+			input:  `{"type":"updateCard","data":{"card":{"name":"Go talk","due":null},"list":{"id":"` + scheduledListID + `"},"old":{"due":"2018-09-17T03:00:00Z"}}}`,
+			output: "Go talk no longer has a date",
+		},
+		"archived": {
+			input:  `{"type":"updateCard","data":{"card":{"name":"Go talk","closed":true},"list":{"id":"` + scheduledListID + `"},"old":{"closed":false}}}`,
+			output: "Go talk has been archived",
+		},
+		"idea archived": {
+			input:  `{"type":"updateCard","data":{"card":{"name":"Go talk","closed":true},"list":{"id":"` + ideasListID + `"},"old":{"closed":false}}}`,
+			output: "",
+		},
+		"meetup due date changed": {
+			input:  `{"type":"updateCard","data":{"card":{"name":"Go night","due":"2018-09-17T03:00:00Z"},"list":{"id":"` + meetupsListID + `"},"old":{"due":null}}}`,
+			output: "",
+		},
+		"renamed": {
+			input:  `{"type":"updateCard","data":{"card":{"name":"Go talk"},"old":{"name":"Golang talk"}}}`,
+			output: "",
+		},
+	}
+
+	for testName, test := range tests {
+		t.Logf("Running test case %s", testName)
+		var a webhookAction
+		assert.NoError(t, json.Unmarshal([]byte(test.input), &a))
+		assert.Equal(t, test.output, announcement(a))
+	}
+}
+
+func TestRegisterTrelloWebhook(t *testing.T) {
+	created := 0
+	existing := `[]`
+	f := func(req *http.Request) (*http.Response, error) {
+		body := `{}`
+		switch req.Method + " " + req.URL.Path {
+		case "GET /1/tokens/token":
+			body = `{"id":"t1"}`
+		case "GET /1/tokens/t1/webhooks":
+			body = existing
+		case "POST /1/webhooks":
+			created++
+		default:
+			return nil, errors.New("unexpected request " + req.URL.String())
+		}
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body))}, nil
+	}
+	srv := server{
+		trello:  newTestTrelloClient(f),
+		webhook: webhookConfig{boardID: "b1", callbackURL: "https://rudolph.example/trello", token: "token"},
+	}
+
+	assert.NoError(t, srv.registerTrelloWebhook())
+	assert.Equal(t, 1, created)
+
+	// one from an earlier run is still there
+	existing = `[{"id":"w1","idModel":"b1","callbackURL":"https://rudolph.example/trello"}]`
+	assert.NoError(t, srv.registerTrelloWebhook())
+	assert.Equal(t, 1, created)
+}
+
+// newTestTrelloClient returns a real trello client that talks to f instead of trello
+func newTestTrelloClient(f RoundTripFunc) *trello.Client {
+	c := trello.NewClient("key", "token")
+	c.Client = &http.Client{Transport: f}
+	return c
+}
+
+func TestListCache(t *testing.T) {
+	requests := 0
+	failing := false
+
+	f := func(req *http.Request) (*http.Response, error) {
+		requests++
+		if failing {
+			return nil, errors.New("trello is down")
+		}
+		body := `{"id":"123"}`
+		if strings.HasSuffix(req.URL.Path, "/cards") {
+			body = `[{"name":"card1"},{"name":"card2"}]`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		}, nil
+	}
+
+	start := time.Date(2018, 9, 17, 0, 30, 0, 0, time.UTC)
+	cache := newListCache(newTestTrelloClient(f), mockClock{t: start}, time.Minute)
+
+	cards, err := cache.getCards("123")
+	assert.NoError(t, err)
+	assert.Len(t, cards, 2)
+	assert.Equal(t, 2, requests)
+
+	// fresh, served from the cache
+	_, err = cache.getCards("123")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	// invalidated, goes back to trello
+	cache.invalidate("123")
+	_, err = cache.getCards("123")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, requests)
+
+	// invalidated while trello was answering, so what came back may be old
+	invalidating := true
+	cache.clock = mockClock{t: start.Add(2 * time.Minute)}
+	inner := f
+	f = func(req *http.Request) (*http.Response, error) {
+		if invalidating {
+			cache.invalidate("123")
+		}
+		return inner(req)
+	}
+	cache.client = newTestTrelloClient(f)
+	_, err = cache.refresh("123")
+	assert.NoError(t, err)
+	assert.True(t, cache.lists["123"].invalid)
+	invalidating = false
+	_, err = cache.getCards("123")
+	assert.NoError(t, err)
+	assert.Equal(t, 8, requests)
+	assert.False(t, cache.lists["123"].invalid)
+
+	// trello is down, we keep serving what we had
+	failing = true
+	cache.invalidate()
+	cards, err = cache.getCards("123")
+	assert.NoError(t, err)
+	assert.Len(t, cards, 2)
+
+	// and don't ask again until the ttl is up
+	requests = 0
+	cache.getCards("123")
+	cache.getCards("123")
+	assert.Equal(t, 0, requests)
+	cache.clock = mockClock{t: start.Add(4 * time.Minute)}
+	cache.getCards("123")
+	assert.Equal(t, 1, requests)
+
+	// nothing cached, so the error comes through
+	_, err = cache.getCards("456")
+	assert.Error(t, err)
+}
+
+func TestTrelloBacklogMove(t *testing.T) {
+	f := func(req *http.Request) (*http.Response, error) {
+		body := `{"id":"c1","idList":"` + ideasListID + `"}`
+		if req.Method == http.MethodPut {
+			body = `{"id":"c1","idList":"` + scheduledListID + `"}`
+		}
+		if strings.HasSuffix(req.URL.Path, "/lists/"+ideasListID) || strings.HasSuffix(req.URL.Path, "/lists/"+scheduledListID) {
+			body = `{"id":"` + strings.TrimPrefix(req.URL.Path, "/1/lists/") + `"}`
+		}
+		if strings.HasSuffix(req.URL.Path, "/cards") {
+			body = `[]`
+		}
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body))}, nil
+	}
+	client := newTestTrelloClient(f)
+	cache := newListCache(client, mockClock{t: time.Now()}, time.Minute)
+	b := &trelloBacklog{client: client, cache: cache}
+	b.Items(ideasList)
+	b.Items(scheduledList)
+
+	assert.NoError(t, b.Move("c1", scheduledList))
+	// both the list it left and the one it went to are read again
+	assert.True(t, cache.lists[ideasListID].invalid)
+	assert.True(t, cache.lists[scheduledListID].invalid)
+}
+
+func TestScheduleIdea(t *testing.T) {
+	b := &testBacklog{}
+	b.Create(ideasList, &backlogItem{Title: "Go modules"})
+	srv := server{backlog: b}
+
+	resp, err := srv.scheduleIdea("schedule on 2018-10-02")
+	assert.NoError(t, err)
+	assert.Equal(t, "tell me when, eg. schedule <talk title> on 2018-10-02", resp)
+	items, _ := b.Items(ideasList)
+	assert.Len(t, items, 1)
+
+	resp, err = srv.scheduleIdea("schedule go modules on 2018-10-02")
+	assert.NoError(t, err)
+	assert.Equal(t, "Go modules is scheduled for Tue 2 Oct", resp)
+}
+
+func TestFileBacklog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rudolph")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := &fileBacklog{path: filepath.Join(dir, "backlog.json")}
+
+	items, err := b.Items(ideasList)
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+
+	first := &backlogItem{Title: "go modules"}
+	assert.NoError(t, b.Create(ideasList, first))
+	assert.NoError(t, b.Create(ideasList, &backlogItem{Title: "generics"}))
+	assert.Equal(t, "1", first.ID)
+
+	due := time.Date(2018, 10, 2, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, b.Move(first.ID, scheduledList))
+	assert.NoError(t, b.SetDue(first.ID, &due))
+	assert.Error(t, b.Move("99", scheduledList))
+
+	ideas, err := b.Items(ideasList)
+	assert.NoError(t, err)
+	assert.Len(t, ideas, 1)
+	assert.Equal(t, "generics", ideas[0].Title)
+
+	scheduled, err := b.Items(scheduledList)
+	assert.NoError(t, err)
+	assert.Len(t, scheduled, 1)
+	assert.Equal(t, "go modules", scheduled[0].Title)
+	assert.True(t, due.Equal(*scheduled[0].Due))
+}
+
+func TestGitHubBacklog(t *testing.T) {
+	f := func(req *http.Request) (*http.Response, error) {
+		if req.Method == "GET" && req.URL.String() == "https://api.github.com/repos/dhruv11/talks/issues?state=open&per_page=100&labels=scheduled" &&
+			req.Header.Get("Authorization") == "token secret" {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(`[{"number":7,"title":"go modules","body":"all about modules\n<!-- due: 2018-10-02T00:00:00Z -->"}]`)),
+			}, nil
+		}
+		if req.Method == "POST" && req.URL.String() == "https://api.github.com/repos/dhruv11/talks/issues" {
+			data, _ := ioutil.ReadAll(req.Body)
+			if string(data) != `{"body":"","labels":["ideas"],"title":"generics"}`+"\n" {
+				return nil, errors.New("unexpected body " + string(data))
+			}
+			return &http.Response{
+				StatusCode: 201,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(`{"number":8,"html_url":"https://github.com/dhruv11/talks/issues/8"}`)),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 404,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"message":"Not Found"}`)),
+		}, nil
+	}
+
+	b := newGitHubBacklog(&http.Client{Transport: RoundTripFunc(f)}, "dhruv11/talks", "secret")
+
+	items, err := b.Items(scheduledList)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "7", items[0].ID)
+	assert.Equal(t, "all about modules", items[0].Description)
+	assert.True(t, time.Date(2018, 10, 2, 0, 0, 0, 0, time.UTC).Equal(*items[0].Due))
+
+	item := &backlogItem{Title: "generics"}
+	assert.NoError(t, b.Create(ideasList, item))
+	assert.Equal(t, "8", item.ID)
+
+	assert.Error(t, b.Move("9", scheduledList))
+}
+
+// testBacklog keeps items in memory
+type testBacklog struct {
+	items []backlogItem
+}
+
+func (b *testBacklog) Items(list string) ([]backlogItem, error) {
+	var res []backlogItem
+	for _, i := range b.items {
+		if i.List == list {
+			res = append(res, i)
+		}
+	}
+	return res, nil
+}
+
+func (b *testBacklog) Create(list string, item *backlogItem) error {
+	item.ID = strconv.Itoa(len(b.items) + 1)
+	item.List = list
+	b.items = append(b.items, *item)
+	return nil
+}
+
+func (b *testBacklog) Move(id, list string) error {
+	i, err := findItem(b.items, id)
+	if err != nil {
+		return err
+	}
+	b.items[i].List = list
+	return nil
+}
+
+func (b *testBacklog) SetDue(id string, due *time.Time) error {
+	i, err := findItem(b.items, id)
+	if err != nil {
+		return err
+	}
+	b.items[i].Due = due
+	return nil
+}
+
+func TestParseMeetupURL(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		group string
+		event string
+		err   bool
+	}{
+		"plain": {
+			input: "https://www.meetup.com/golang-nz/events/254375678/",
+			group: "golang-nz",
+			event: "254375678",
+		},
+		"slack formatted": {
+			input: "<https://www.meetup.com/golang-nz/events/254375678/|Go meetup>",
+			group: "golang-nz",
+			event: "254375678",
+		},
+		"locale and query": {
+			input: "<https://www.meetup.com/en-AU/golang-nz/events/qxvzplyxnbhc/?isFirstPublish=true>",
+			group: "golang-nz",
+			event: "qxvzplyxnbhc",
+		},
+		"no scheme": {
+			input: "meetup.com/golang-nz/events/254375678",
+			group: "golang-nz",
+			event: "254375678",
+		},
+		"group page": {
+			input: "https://www.meetup.com/golang-nz/",
+			err:   true,
+		},
+		"not meetup": {
+			input: "https://www.notmeetup.com/golang-nz/events/254375678/",
+			err:   true,
+		},
+	}
+
+	for testName, test := range tests {
+		t.Logf("Running test case %s", testName)
+		group, event, err := parseMeetupURL(test.input)
+		assert.Equal(t, test.err, err != nil)
+		assert.Equal(t, test.group, group)
+		assert.Equal(t, test.event, event)
+	}
+}
+
+func TestAddMeetup(t *testing.T) {
+	f := func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() == "https://api.meetup.com/golang-nz/events/254375678" {
+			return &http.Response{
+				StatusCode: 200,
+				Body: ioutil.NopCloser(bytes.NewBufferString(`{"name":"Go night","local_date":"2018-09-20","local_time":"18:00",
+					"utc_offset":43200000,"yes_rsvp_count":42,"link":"https://www.meetup.com/golang-nz/events/254375678/",
+					"venue":{"name":"ASB North Wharf","address_1":"12 Jellicoe St","city":"Auckland"}}`)),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 404,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"errors":[]}`)),
+		}, nil
+	}
+
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("PostMessage", "C1", mock.Anything, mock.Anything).Return("C1", "123.456", nil)
+	rtm.On("AddReaction", goingReaction, slack.NewRefToMessage("C1", "123.456")).Return(nil)
+	rtm.On("AddReaction", maybeReaction, slack.NewRefToMessage("C1", "123.456")).Return(nil)
+
+	b := &testBacklog{}
+	srv := server{backlog: b, slack: rtm, store: newStore("")}
+	client := &http.Client{Transport: RoundTripFunc(f)}
+
+	resp, err := srv.addMeetup(client, "<https://www.meetup.com/golang-nz/events/254375678/>", "C1")
+	assert.NoError(t, err)
+	assert.Equal(t, "", resp)
+	rtm.AssertExpectations(t)
+	assert.Len(t, b.items, 1)
+	assert.Equal(t, "Go night - https://www.meetup.com/golang-nz/events/254375678/", b.items[0].Title)
+	assert.Equal(t, "Venue: ASB North Wharf, 12 Jellicoe St, Auckland\nGoing: 42\nhttps://www.meetup.com/golang-nz/events/254375678/", b.items[0].Description)
+	assert.True(t, time.Date(2018, 9, 20, 6, 0, 0, 0, time.UTC).Equal(*b.items[0].Due))
+
+	_, err = srv.addMeetup(client, "<https://www.meetup.com/golang-nz/events/1/>", "C1")
+	assert.Error(t, err)
+	assert.Len(t, b.items, 1)
+
+	// people react to the announcement
+	assert.NoError(t, srv.recordRSVP("U1", goingReaction, "123.456", true))
+	assert.NoError(t, srv.recordRSVP("U2", goingReaction, "123.456", true))
+	assert.NoError(t, srv.recordRSVP("U3", maybeReaction, "123.456", true))
+	assert.NoError(t, srv.recordRSVP("U2", goingReaction, "123.456", false))
+	assert.NoError(t, srv.recordRSVP("U4", "tada", "123.456", true))
+	assert.NoError(t, srv.recordRSVP("U4", goingReaction, "999.999", true))
+
+	resp, err = srv.whosGoing("who's going to go night?")
+	assert.NoError(t, err)
+	assert.Equal(t, "Go night - going: <@U1>, maybe: <@U3>\n", resp)
+
+	resp, err = srv.whosGoing("who's going to rust night")
+	assert.NoError(t, err)
+	assert.Equal(t, "I don't know of a meetup called rust night", resp)
+}
+
+func TestGetMeetupReminders(t *testing.T) {
+	nz := loadLocation("Pacific/Auckland")
+	// 7:30am in auckland is the day before in UTC
+	breakfast := time.Date(2018, 9, 20, 7, 30, 0, 0, nz).UTC()
+	evening := time.Date(2018, 9, 20, 18, 0, 0, 0, nz).UTC()
+	tomorrow := time.Date(2018, 9, 21, 7, 30, 0, 0, nz).UTC()
+	b := &testBacklog{}
+	b.Create(meetupsList, &backlogItem{Title: "Breakfast", Due: &breakfast})
+	b.Create(meetupsList, &backlogItem{Title: "Go night", Due: &evening})
+	b.Create(meetupsList, &backlogItem{Title: "Tomorrow", Due: &tomorrow})
+	srv := server{backlog: b, store: newStore("")}
+
+	resp, err := srv.getMeetupReminders(time.Date(2018, 9, 20, 6, 0, 0, 0, nz))
+	assert.NoError(t, err)
+	assert.Equal(t, "It's your lucky day, we have a meetup later today:\nBreakfast\nGo night\n", resp)
+
+	resp, err = srv.getMeetupReminders(time.Date(2018, 9, 19, 20, 0, 0, 0, nz))
+	assert.NoError(t, err)
+	assert.Equal(t, "", resp)
+}
+
+func TestParseICS(t *testing.T) {
+	ics := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\nUID:1\r\nSUMMARY:Go night\\, with pizza\r\nDTSTART;TZID=Pacific/Auckland:20180920T180000\r\n" +
+		"DESCRIPTION:Talks about\r\n  modules\\nand more\r\nLOCATION:ASB North Wharf\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nSUMMARY:Gophercon\r\nDTSTART:20180828T160000Z\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nSUMMARY:Hack day\r\nDTSTART;VALUE=DATE:20181005\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nSUMMARY:Mars night\r\nDTSTART;TZID=Mars/Olympus:20181005T180000\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nSUMMARY:No start\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	events, skipped, err := parseICS([]byte(ics))
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+	assert.Len(t, skipped, 2)
+	assert.Contains(t, skipped[0], "Mars night: Unknown calendar timezone: Mars/Olympus")
+	assert.Equal(t, "No start: it has no start", skipped[1])
+	assert.Equal(t, "Go night, with pizza", events[0].Summary)
+	assert.Equal(t, "Talks about modules\nand more", events[0].Description)
+	assert.Equal(t, "ASB North Wharf", events[0].Location)
+	assert.True(t, time.Date(2018, 9, 20, 6, 0, 0, 0, time.UTC).Equal(events[0].Start))
+	assert.True(t, time.Date(2018, 8, 28, 16, 0, 0, 0, time.UTC).Equal(events[1].Start))
+	assert.True(t, time.Date(2018, 10, 5, 0, 0, 0, 0, time.UTC).Equal(events[2].Start))
+
+	_, _, err = parseICS([]byte("SUMMARY:No begin\r\nEND:VEVENT\r\n"))
+	assert.Error(t, err)
+}
+
+func TestWriteICS(t *testing.T) {
+	due := time.Date(2018, 9, 20, 6, 0, 0, 0, time.UTC)
+	items := []backlogItem{
+		{ID: "1", List: meetupsList, Title: "Go night, with pizza", Description: "Venue: ASB; North Wharf", Due: &due},
+		{ID: "2", List: ideasList, Title: "No date"},
+	}
+
+	var b bytes.Buffer
+	assert.NoError(t, writeICS(&b, "Meetups", items, due))
+	assert.Contains(t, b.String(), "SUMMARY:Go night\\, with pizza\r\n")
+	assert.NotContains(t, b.String(), "No date")
+
+	events, _, err := parseICS(b.Bytes())
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "Go night, with pizza", events[0].Summary)
+	assert.Equal(t, "Venue: ASB; North Wharf", events[0].Description)
+	assert.True(t, due.Equal(events[0].Start))
+}
+
+func TestICSFeedURL(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		output string
+	}{
+		"ics link":   {input: "<https://example.com/Events/Go.ics>", output: "https://example.com/Events/Go.ics"},
+		"webcal":     {input: "<webcal://example.com/go.ics|Go calendar>", output: "https://example.com/go.ics"},
+		"eventbrite": {input: "<https://www.eventbrite.co.nz/e/gophers-night-tickets-49920412345>", output: "https://www.eventbrite.com/calendar.ics?eid=49920412345&calendar=ical"},
+		"luma":       {input: "<https://lu.ma/gophers>", output: "https://api.lu.ma/ics/get?entity=event&id=gophers"},
+		"other":      {input: "<https://example.com/go>", output: ""},
+		"not a link": {input: "add go modules", output: ""},
+	}
+
+	for testName, test := range tests {
+		t.Logf("Running test case %s", testName)
+		output, ok := icsFeedURL(test.input)
+		assert.Equal(t, test.output != "", ok)
+		assert.Equal(t, test.output, output)
+	}
+}
+
+func TestAddCalendarLink(t *testing.T) {
+	f := func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() == "https://example.com/Go.ics" {
+			return &http.Response{
+				StatusCode: 200,
+				Body: ioutil.NopCloser(bytes.NewBufferString("BEGIN:VCALENDAR\r\n" +
+					"BEGIN:VEVENT\r\nSUMMARY:Past\r\nDTSTART:20000101T000000Z\r\nEND:VEVENT\r\n" +
+					"BEGIN:VEVENT\r\nUID:future-1\r\nSUMMARY:Future\r\nDTSTART:20990101T000000Z\r\nEND:VEVENT\r\n" +
+					"BEGIN:VEVENT\r\nSUMMARY:Somewhere\r\nDTSTART;TZID=Nowhere/Special:20990101T000000\r\nEND:VEVENT\r\n" +
+					"END:VCALENDAR\r\n")),
+			}, nil
+		}
+		return nil, errors.New("unexpected request")
+	}
+
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("PostMessage", "C1", mock.MatchedBy(func(text string) bool {
+		return strings.HasPrefix(text, "I've added Future from that calendar to the trello board for you :)\nGoing to Future?")
+	}), mock.Anything).Return("C1", "123.456", nil).Once()
+	rtm.On("AddReaction", mock.Anything, slack.NewRefToMessage("C1", "123.456")).Return(nil).Twice()
+
+	b := &testBacklog{}
+	srv := server{backlog: b, slack: rtm, store: newStore("")}
+	client := &http.Client{Transport: RoundTripFunc(f)}
+
+	resp, err := srv.addCalendarLink(client, "<https://example.com/Go.ics>", "C1")
+	assert.NoError(t, err)
+	assert.Equal(t, "I skipped Somewhere: Unknown calendar timezone: Nowhere/Special: unknown time zone Nowhere/Special", resp)
+	assert.Len(t, b.items, 1)
+	assert.Equal(t, meetupsList, b.items[0].List)
+
+	// importing it again doesn't add it twice
+	resp, err = srv.addCalendarLink(client, "<https://example.com/Go.ics>", "C1")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(resp, "Future is already on the trello board\n"))
+	assert.Len(t, b.items, 1)
+	rtm.AssertExpectations(t)
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rudolph")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := newStore(filepath.Join(dir, "data"))
+
+	counts := make(map[string]int)
+	assert.NoError(t, s.load("counts", &counts))
+	assert.Empty(t, counts)
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, s.update("counts", &counts, func() error {
+			counts["a"]++
+			return nil
+		}))
+	}
+
+	// a new store on the same dir sees what was saved
+	loaded := make(map[string]int)
+	assert.NoError(t, newStore(filepath.Join(dir, "data")).load("counts", &loaded))
+	assert.Equal(t, map[string]int{"a": 2}, loaded)
+}
+
+func TestMeetupLinks(t *testing.T) {
+	text := "anyone keen? <https://www.meetup.com/golang-nz/events/254375678/|Go night> and " +
+		"<https://www.meetup.com/rust-akl/events/254375679/> also <https://www.meetup.com/golang-nz/events/254375678/> " +
+		"<https://www.meetup.com/golang-nz/> <https://example.com>"
+	attachments := []slack.Attachment{
+		{TitleLink: "https://www.meetup.com/js-akl/events/254375680/"},
+		{Text: "see https://www.meetup.com/py-akl/events/254375681/ for details"},
+	}
+
+	assert.Equal(t, []string{
+		"https://www.meetup.com/golang-nz/events/254375678/",
+		"https://www.meetup.com/rust-akl/events/254375679/",
+		"https://www.meetup.com/js-akl/events/254375680/",
+		"https://www.meetup.com/py-akl/events/254375681/",
+	}, meetupLinks(text, attachments))
+
+	assert.Empty(t, meetupLinks("meetup.com is great", nil))
+}
+
+func TestConfirmMeetups(t *testing.T) {
+	failing := false
+	f := func(req *http.Request) (*http.Response, error) {
+		if failing {
+			return nil, errors.New("meetup is down")
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body: ioutil.NopCloser(bytes.NewBufferString(`{"name":"Go night","local_date":"2018-09-20","local_time":"18:00",
+				"link":"https://www.meetup.com/golang-nz/events/254375678/"}`)),
+		}, nil
+	}
+
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("PostMessage", "C1", mock.Anything, mock.Anything).Return("C1", "200.000", nil)
+	rtm.On("AddReaction", mock.Anything, mock.Anything).Return(nil)
+
+	b := &testBacklog{}
+	srv := server{backlog: b, slack: rtm, store: newStore("")}
+	client := &http.Client{Transport: RoundTripFunc(f)}
+
+	assert.NoError(t, srv.offerMeetups("C1", "100.000", []string{"https://www.meetup.com/golang-nz/events/254375678/"}))
+
+	// only a thumbs up on the offer adds it, and only once
+	assert.NoError(t, srv.confirmMeetups(client, "tada", "200.000"))
+	assert.NoError(t, srv.confirmMeetups(client, confirmReaction, "999.000"))
+	assert.Empty(t, b.items)
+
+	// it didn't get added, so it can be tried again
+	failing = true
+	assert.Error(t, srv.confirmMeetups(client, confirmReaction, "200.000"))
+	assert.Empty(t, b.items)
+	failing = false
+
+	assert.NoError(t, srv.confirmMeetups(client, confirmReaction, "200.000"))
+	assert.NoError(t, srv.confirmMeetups(client, confirmReaction, "200.000"))
+	assert.Len(t, b.items, 1)
+	assert.Equal(t, "Go night - https://www.meetup.com/golang-nz/events/254375678/", b.items[0].Title)
+}
+
+func TestMeetupLinkInCommand(t *testing.T) {
+	b := &testBacklog{}
+	srv := server{backlog: b, store: newStore(""), sched: newScheduler(mockClock{t: time.Now()})}
+	info := &slack.Info{User: &slack.UserDetails{ID: "BOT"}}
+
+	// an idea that mentions a meetup is still an idea
+	msg := &slack.MessageEvent{Msg: slack.Msg{User: "U1", Channel: "C1", Text: "<@BOT> add Go modules, like <https://www.meetup.com/golang-nz/events/254375678/>"}}
+	_, err := srv.processMessage(msg, info, "<@BOT> ", nil)
+	assert.NoError(t, err)
+	assert.Len(t, b.items, 1)
+	assert.Equal(t, ideasList, b.items[0].List)
+}
+
+func TestScheduler(t *testing.T) {
+	runs := 0
+	s := newScheduler(mockClock{t: time.Date(2018, 9, 16, 21, 0, 10, 0, time.UTC)})
+	s.add("test", weekly(loadLocation("Pacific/Auckland"), time.Monday, 9, 0), func() error {
+		runs++
+		return nil
+	})
+
+	// latency reports come every 30 seconds, but we only run once
+	s.tick()
+	s.clock = mockClock{t: time.Date(2018, 9, 16, 21, 0, 40, 0, time.UTC)}
+	s.tick()
+	assert.Equal(t, 1, runs)
+
+	s.clock = mockClock{t: time.Date(2018, 9, 16, 21, 1, 10, 0, time.UTC)}
+	s.tick()
+	assert.Equal(t, 1, runs)
+
+	s.clock = mockClock{t: time.Date(2018, 9, 23, 21, 0, 10, 0, time.UTC)}
+	s.tick()
+	assert.Equal(t, 2, runs)
+}
+
+func TestMeetupDigest(t *testing.T) {
+	f := func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() == "https://api.meetup.com/golang-nz/events?status=upcoming&page=20" {
+			return &http.Response{
+				StatusCode: 200,
+				Body: ioutil.NopCloser(bytes.NewBufferString(`[
+					{"name":"Go night","local_date":"2018-09-20","local_time":"18:00","link":"https://www.meetup.com/golang-nz/events/1/"},
+					{"name":"Already on the board","local_date":"2018-09-21","local_time":"18:00","link":"https://www.meetup.com/golang-nz/events/2/"},
+					{"name":"Too far away","local_date":"2018-12-20","local_time":"18:00","link":"https://www.meetup.com/golang-nz/events/3/"}]`)),
+			}, nil
+		}
+		if req.URL.String() == "https://example.com/rust.ics" {
+			return &http.Response{
+				StatusCode: 200,
+				Body: ioutil.NopCloser(bytes.NewBufferString("BEGIN:VCALENDAR\r\n" +
+					"BEGIN:VEVENT\r\nSUMMARY:Rust night\r\nDTSTART:20180918T060000Z\r\nEND:VEVENT\r\n" +
+					"END:VCALENDAR\r\n")),
+			}, nil
+		}
+		return nil, errors.New("unexpected request")
+	}
+	client := &http.Client{Transport: RoundTripFunc(f)}
+
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("PostMessage", "C2", mock.MatchedBy(func(text string) bool {
+		return strings.Contains(text, ":one: Rust night") && strings.Contains(text, ":two: Go night") &&
+			!strings.Contains(text, "Already on the board") && !strings.Contains(text, "Too far away")
+	}), mock.Anything).Return("C2", "300.000", nil).Once()
+	rtm.On("AddReaction", mock.Anything, slack.NewRefToMessage("C2", "300.000")).Return(nil).Twice()
+
+	b := &testBacklog{}
+	b.Create(meetupsList, &backlogItem{Title: "Already on the board - https://www.meetup.com/golang-nz/events/2/"})
+
+	srv := server{
+		backlog: b,
+		slack:   rtm,
+		store:   newStore(""),
+		config:  config{Meetups: meetupsConfig{Groups: []string{"golang-nz"}, Feeds: []string{"https://example.com/rust.ics"}, Channel: "C2"}},
+	}
+
+	now := time.Date(2018, 9, 17, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, srv.postMeetupDigest(client, now))
+	// nothing new the second time round
+	assert.NoError(t, srv.postMeetupDigest(client, now))
+	rtm.AssertExpectations(t)
+
+	// someone picks Go night
+	rtm.On("PostMessage", "C2", mock.MatchedBy(func(text string) bool {
+		return strings.HasPrefix(text, "I've added Go night to the trello board for you :)")
+	}), mock.Anything).Return("C2", "400.000", nil).Once()
+	rtm.On("AddReaction", mock.Anything, slack.NewRefToMessage("C2", "400.000")).Return(nil).Twice()
+
+	assert.NoError(t, srv.addRecommendation("two", "300.000"))
+	assert.NoError(t, srv.addRecommendation("two", "300.000"))
+	items, _ := b.Items(meetupsList)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "Go night - https://www.meetup.com/golang-nz/events/1/", items[1].Title)
+}
+
+func TestParseCarpool(t *testing.T) {
+	// a thursday morning in auckland
+	now := time.Date(2018, 9, 19, 20, 0, 0, 0, time.UTC)
+
+	d, err := parseCarpool(strings.Fields("3 seats from mt eden 8:30am on friday"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, d.seats)
+	assert.Equal(t, "Mt Eden", d.suburb)
+	assert.Equal(t, "8:30am", d.at)
+	assert.Equal(t, "2018-09-21", d.date())
+
+	d, err = parseCarpool(strings.Fields("ride"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, "", d.suburb)
+	assert.Equal(t, "2018-09-21", d.date())
+
+	d, err = parseCarpool(strings.Fields("1 seat from ponsonby today"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, d.seats)
+	assert.Equal(t, "2018-09-20", d.date())
+
+	d, err = parseCarpool(strings.Fields("on 2018-09-27"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, "2018-09-27", d.date())
+
+	_, err = parseCarpool(strings.Fields("on 2018-09-01"), now)
+	assert.Error(t, err)
+}
+
+func TestMatchCarpools(t *testing.T) {
+	drivers := []driver{
+		{Name: "Ann", Address: "Ponsonby", Seats: 1},
+		{Name: "Bob", Address: "Mt Eden", Seats: 2},
+	}
+	passengers := []passenger{
+		{Name: "Cat", Address: "Mount Eden"},
+		{Name: "Dan", Address: "Ponsonby"},
+		{Name: "Eve", Address: "Ponsonby"},
+		{Name: "Fay"},
+	}
+
+	cfg := carpoolConfig{Areas: map[string][]string{"central": {"Ponsonby", "Grey Lynn"}}}
+
+	groups, left := matchCarpools(drivers, passengers, cfg.area)
+	assert.Equal(t, []passenger{{Name: "Dan", Address: "Ponsonby"}}, groups[0].Passengers)
+	assert.Equal(t, []passenger{{Name: "Cat", Address: "Mount Eden"}, {Name: "Eve", Address: "Ponsonby"}}, groups[1].Passengers)
+	assert.Equal(t, []passenger{{Name: "Fay"}}, left)
+
+	// grey lynn is close enough to ponsonby to go before anyone else
+	passengers = append([]passenger{{Name: "Gus"}}, passengers...)
+	passengers[2].Address = "Grey Lynn"
+	groups, _ = matchCarpools(drivers[:1], passengers, cfg.area)
+	assert.Equal(t, []passenger{{Name: "Eve", Address: "Ponsonby"}}, groups[0].Passengers)
+	drivers[0].Seats = 2
+	groups, _ = matchCarpools(drivers[:1], passengers, cfg.area)
+	assert.Equal(t, []passenger{{Name: "Eve", Address: "Ponsonby"}, {Name: "Dan", Address: "Grey Lynn"}}, groups[0].Passengers)
+}
+
+func TestNewCarpoolService(t *testing.T) {
+	_, ok := newCarpoolService(carpoolConfig{}, &http.Client{}, newStore("")).(*storeCarpool)
+	assert.True(t, ok)
+
+	c, ok := newCarpoolService(carpoolConfig{URL: "https://carpool.example.com/"}, &http.Client{}, newStore("")).(*carpoolClient)
+	assert.True(t, ok)
+	assert.Equal(t, "https://carpool.example.com", c.baseURL)
+}
+
+func TestCarpoolSignup(t *testing.T) {
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("PostMessage", "C3", "Who's carpooling tomorrow (Fri 21 Sep)? React with :car: if you can drive or :raising_hand: if you need a ride", mock.Anything).Return("C3", "500.000", nil).Once()
+	rtm.On("AddReaction", mock.Anything, slack.NewRefToMessage("C3", "500.000")).Return(nil).Twice()
+	rtm.On("OpenIMChannel", mock.Anything).Return(false, false, "D1", nil)
+	var sent []string
+	onSendMessage(rtm, func(channel, text string) { sent = append(sent, text) })
+
+	st := newStore("")
+	srv := server{slack: rtm, store: st, carpools: &storeCarpool{store: st}, config: config{Carpool: carpoolConfig{Channel: "C3"}}}
+
+	// thursday afternoon in auckland
+	now := time.Date(2018, 9, 20, 2, 0, 0, 0, time.UTC)
+	assert.NoError(t, srv.postCarpoolSignup(now))
+	// nothing on friday for the weekend
+	assert.NoError(t, srv.postCarpoolSignup(now.AddDate(0, 0, 1)))
+
+	_, err := srv.carpool("U1", "carpool home ponsonby", now)
+	assert.NoError(t, err)
+	_, err = srv.carpool("U2", "carpool home ponsonby", now)
+	assert.NoError(t, err)
+
+	assert.NoError(t, srv.carpoolSignup("U1", "car", "500.000", true))
+	assert.NoError(t, srv.carpoolSignup("U2", "raising_hand", "500.000", true))
+	assert.NoError(t, srv.carpoolSignup("U3", "raising_hand", "500.000", true))
+	assert.NoError(t, srv.carpoolSignup("U3", "car", "500.000", false))
+	assert.Equal(t, []string{"I don't know where you live, tell me with @rudolph carpool home <suburb> so I can find you a carpool"}, sent)
+
+	// U3 changed their mind
+	assert.NoError(t, srv.carpoolSignup("U3", "raising_hand", "500.000", false))
+	passengers, _ := srv.carpools.Passengers(time.Date(2018, 9, 21, 0, 0, 0, 0, loadLocation("Pacific/Auckland")))
+	assert.Len(t, passengers, 1)
+
+	sent = nil
+	assert.NoError(t, srv.sendCarpoolMatches(now))
+	assert.Equal(t, []string{
+		"You're picking up <@U2> from Ponsonby tomorrow, thanks for driving :)",
+		"Carpools for Fri 21 Sep:\n<@U1> from Ponsonby is taking <@U2>\n",
+	}, sent)
+	rtm.AssertExpectations(t)
+}
+
+func TestCarpool(t *testing.T) {
+	srv := server{carpools: &storeCarpool{store: newStore("")}, store: newStore("")}
+	now := time.Date(2018, 9, 19, 20, 0, 0, 0, time.UTC)
+
+	resp, err := srv.carpool("U1", "carpool offer 3 seats from ponsonby 8am", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "Thanks <@U1>, you're down for 3 seats from Ponsonby at 8am on Fri 21 Sep", resp)
+
+	resp, err = srv.carpool("U2", "carpool need ride from mt eden", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "Got it <@U2>, you need a ride on Fri 21 Sep. Ask me for carpool matches to see who's driving", resp)
+
+	resp, err = srv.carpool("U2", "carpool matches tomorrow", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "Carpools for Fri 21 Sep:\n<@U1> from Ponsonby at 8am is taking <@U2>\n", resp)
+
+	resp, err = srv.getPassengers("who wants to carpool tomorrow", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "Your choices are:\n<@U2> from Mt Eden\n", resp)
+}
+
+func TestCarpoolClient(t *testing.T) {
+	f := func(req *http.Request) (*http.Response, error) {
+		if req.Method+" "+req.URL.String() == "GET https://carpool.example.com/passengers" {
+			return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(
+				`[{"Name":"Dan","Address":"Ponsonby"},{"Name":"Cat","Address":"Mt Eden","Date":"2018-09-22"}]`))}, nil
+		}
+		return nil, errors.New("unexpected request " + req.URL.String())
+	}
+	client := &http.Client{Transport: RoundTripFunc(f)}
+	srv := server{carpools: newCarpoolClient(client, "https://carpool.example.com/"), store: newStore("")}
+	now := time.Date(2018, 9, 19, 20, 0, 0, 0, time.UTC)
+
+	resp, err := srv.getPassengers("who wants to carpool tomorrow", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "Your choices are:\nDan from Ponsonby\n", resp)
+
+	// it can't take offers or match anyone, so say so instead of failing quietly
+	resp, err = srv.carpool("U1", "carpool offer 3 seats from ponsonby 8am", now)
+	assert.NoError(t, err)
+	assert.Equal(t, errCarpoolReadOnly.Error(), resp)
+	resp, err = srv.carpool("U2", "carpool need ride from ponsonby", now)
+	assert.NoError(t, err)
+	assert.Equal(t, errCarpoolReadOnly.Error(), resp)
+	resp, err = srv.carpool("U2", "carpool matches tomorrow", now)
+	assert.NoError(t, err)
+	assert.Equal(t, errCarpoolReadOnly.Error(), resp)
+}
+
+func TestHWR(t *testing.T) {
+	var sent []string
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("OpenIMChannel", mock.Anything).Return(false, false, "D1", nil)
+	onSendMessage(rtm, func(channel, text string) { sent = append(sent, text) })
+	rtm.On("GetUserInfo", "U2").Return(&slack.User{RealName: "Ruskin"}, nil)
+	rtm.On("GetUserInfo", mock.Anything).Return(nil, errors.New("user_not_found"))
+
+	srv := server{slack: rtm, store: newStore("")}
+	now := time.Date(2018, 9, 20, 0, 0, 0, 0, time.UTC)
+
+	resp, dmed, err := srv.hwr("U1", "hwr <@U2> CC It was awesome when you rapped for all of us", now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"U2"}, dmed)
+	assert.Equal(t, "I've passed on your feedback to Ruskin anonymously! \n Good on you for being a Recognized Reveller :)", resp)
+	assert.Equal(t, "Wohoo! Someone just nominated you for being a crystal clear carer!\n They said \"It was awesome when you rapped for all of us\"", sent[0])
+	srv.hwr("U1", "hwr <@U3> ge Shipped it", now)
+	srv.hwr("U4", "hwr <@U2> cc Thanks", now.AddDate(0, -1, 0))
+
+	resp, _, err = srv.hwr("U1", "hwr nobody", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "Tell me who and what for, eg. hwr @ruskin.dantra CC It was awesome when you rapped for all of us", resp)
+
+	resp, _, err = srv.hwr("U1", "hwr <@U2> xx Nice", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "I don't know the behaviour xx, try one of RR (recognized reveller), DD (dedicated discoverer), CC (crystal clear carer), PP (punter passion), GE (gutsy evolver), RA (rapid adapter)", resp)
+
+	resp, _, err = srv.hwr("U1", "hwr behaviours", now)
+	assert.NoError(t, err)
+	assert.Contains(t, resp, "GE - gutsy evolver, tries the bold thing and learns from it\n")
+
+	resp, _, err = srv.hwr("U1", "hwr stats", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "Recognitions so far:\ncrystal clear carer: 2\ngutsy evolver: 1\nTotal: 3", resp)
+
+	resp, _, err = srv.hwr("U1", "HWR leaderboard", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "Most recognised in September:\n1. <@U2> 1\n2. <@U3> 1", resp)
+
+	// the digest doesn't give away who nominated who
+	sent = nil
+	assert.NoError(t, srv.postHWRDigest(now.Add(time.Hour)))
+	assert.Equal(t, []string{"This week's HWR recognitions:\n" +
+		":tada: <@U2> for being a crystal clear carer: \"It was awesome when you rapped for all of us\"\n" +
+		":tada: <@U3> for being a gutsy evolver: \"Shipped it\"\n"}, sent)
+	assert.NotContains(t, sent[0], "U1")
+}
+
+func TestHWRMultipleNominees(t *testing.T) {
+	var sent []string
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("OpenIMChannel", "U9").Return(false, false, "", errors.New("user_not_found"))
+	rtm.On("OpenIMChannel", mock.Anything).Return(false, false, "D1", nil)
+	onSendMessage(rtm, func(channel, text string) { sent = append(sent, text) })
+	rtm.On("GetUserInfo", "U2").Return(&slack.User{RealName: "Ruskin"}, nil)
+	rtm.On("GetUserInfo", "U3").Return(&slack.User{RealName: "Dhruv"}, nil)
+
+	cfg := config{HWR: hwrConfig{Behaviours: []behaviour{{Code: "ts", Name: "team spirit", Emoji: "raised_hands"}}}}
+	srv := server{slack: rtm, store: newStore(""), config: cfg}
+
+	resp, dmed, err := srv.hwr("U1", "hwr <@U2> <@u3|dhruv> TS Great launch", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"U2", "U3"}, dmed)
+	assert.Equal(t, "I've passed on your feedback to Ruskin and Dhruv anonymously! \n Good on you for being a Recognized Reveller :)", resp)
+	assert.Len(t, sent, 2)
+	assert.Equal(t, "Wohoo! Someone just nominated you for being a team spirit!\n They said \"Great launch\"", sent[1])
+
+	resp, dmed, err = srv.hwr("U1", "hwr <@U2> cc Great launch", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, "I don't know the behaviour cc, try one of TS (team spirit)", resp)
+	assert.Empty(t, dmed)
+
+	// nobody gets nominated if we can't reach one of them
+	resp, dmed, err = srv.hwr("U1", "hwr <@U2> <@U9> TS Great launch", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, "I couldn't get through to <@U9> so I haven't passed on your feedback to anyone, try again in a bit", resp)
+	assert.Empty(t, dmed)
+	assert.Len(t, sent, 2)
+	var nominations []nomination
+	assert.NoError(t, srv.store.load(nominationsKey, &nominations))
+	assert.Len(t, nominations, 2)
+}
+
+func TestHWRReaction(t *testing.T) {
+	var sent []string
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("GetInfo").Return(&slack.Info{User: &slack.UserDetails{ID: "BOT"}, Team: &slack.Team{Domain: "xero"}})
+	rtm.On("OpenIMChannel", mock.Anything).Return(false, false, "D1", nil)
+	onSendMessage(rtm, func(channel, text string) { sent = append(sent, text) })
+	rtm.On("GetUserInfo", mock.Anything).Return(&slack.User{RealName: "Ruskin"}, nil)
+
+	srv := server{slack: rtm, store: newStore("")}
+	now := time.Date(2018, 9, 20, 0, 0, 0, 0, time.UTC)
+
+	// reactions only nominate people once the config gives behaviours emojis
+	dmed, err := srv.hwrReaction("U1", "U2", "muscle", "C1", "1537401600.000100", now)
+	assert.NoError(t, err)
+	assert.False(t, dmed)
+	assert.Empty(t, sent)
+
+	srv.config.HWR.Behaviours = []behaviour{{Code: "ge", Name: "gutsy evolver", Emoji: "muscle"}}
+	dmed, err = srv.hwrReaction("U1", "U2", "muscle", "C1", "1537401600.000100", now)
+	assert.NoError(t, err)
+	assert.True(t, dmed)
+	assert.Equal(t, []string{"Wohoo! Someone just nominated you for being a gutsy evolver!\n It was for <https://xero.slack.com/archives/C1/p1537401600000100|this message>"}, sent)
+
+	// the same reaction again, other emojis, their own messages and the bot's don't count
+	for _, r := range [][]string{{"U1", "U2", "muscle"}, {"U1", "U2", "thumbsup"}, {"U2", "U2", "muscle"}, {"U1", "BOT", "muscle"}} {
+		dmed, err = srv.hwrReaction(r[0], r[1], r[2], "C1", "1537401600.000100", now)
+		assert.NoError(t, err)
+		assert.False(t, dmed)
+	}
+	assert.Len(t, sent, 1)
+
+	sent = nil
+	assert.NoError(t, srv.postHWRDigest(now.Add(time.Hour)))
+	assert.Equal(t, []string{"This week's HWR recognitions:\n:muscle: <@U2> for being a gutsy evolver in <https://xero.slack.com/archives/C1/p1537401600000100|this message>\n"}, sent)
+}
+
+func TestHWRExport(t *testing.T) {
+	var uploaded []slack.FileUploadParameters
+	var contents []string
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("OpenIMChannel", mock.Anything).Return(false, false, "D1", nil)
+	rtm.On("NewOutgoingMessage", mock.Anything, mock.Anything).Return(&slack.OutgoingMessage{})
+	rtm.On("SendMessage", mock.Anything)
+	rtm.On("GetUserInfo", mock.Anything).Return(&slack.User{RealName: "Ruskin Dantra"}, nil)
+	rtm.On("UploadFile", mock.Anything).Run(func(args mock.Arguments) {
+		p := args.Get(0).(slack.FileUploadParameters)
+		data, _ := ioutil.ReadAll(p.Reader)
+		uploaded = append(uploaded, p)
+		contents = append(contents, string(data))
+	}).Return(&slack.File{}, nil)
+
+	srv := server{slack: rtm, store: newStore(""), config: config{HWR: hwrConfig{Managers: []string{"UBOSS"}}}}
+	now := time.Date(2018, 9, 20, 0, 0, 0, 0, time.UTC)
+	srv.hwr("U1", "hwr <@U2> cc It was awesome, when you rapped", now)
+	srv.hwr("U3", "hwr <@U2> ge Shipped it", now.AddDate(0, -2, 0))
+	srv.hwr("U1", "hwr <@U3> ge Shipped it too", now)
+
+	resp, _, err := srv.hwr("U4", "hwr export <@U2>", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "Sorry, only managers can export other people's recognitions", resp)
+	assert.Empty(t, uploaded)
+
+	resp, _, err = srv.hwr("U2", "hwr export <@U2> since 2018-09-01 csv", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "I've DMed you 1 recognition for Ruskin Dantra", resp)
+	assert.Equal(t, []string{"D1"}, uploaded[0].Channels)
+	assert.Equal(t, "hwr-ruskin-dantra.csv", uploaded[0].Filename)
+	assert.Equal(t, "date,behaviour,message,link\n2018-09-20,crystal clear carer,\"It was awesome, when you rapped\",\n", contents[0])
+
+	resp, _, err = srv.hwr("UBOSS", "hwr export <@U2>", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "I've DMed you 2 recognitions for Ruskin Dantra", resp)
+	assert.Equal(t, "# HWR recognitions for Ruskin Dantra ever\n\n- crystal clear carer: 1\n- gutsy evolver: 1\n\n"+
+		"| Date | Behaviour | Message |\n| --- | --- | --- |\n"+
+		"| 20 Jul 2018 | gutsy evolver | Shipped it |\n| 20 Sep 2018 | crystal clear carer | It was awesome, when you rapped |\n", contents[1])
+	assert.NotContains(t, contents[1], "U1")
+
+	resp, _, err = srv.hwr("UBOSS", "hwr export <@U2> since tuesday", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "I don't know when tuesday is, Try hwr export @ruskin.dantra since 2018-04-01, add csv on the end for a spreadsheet", resp)
+}
+
+func TestHWRConfigValidate(t *testing.T) {
+	assert.NoError(t, hwrConfig{}.validate())
+	assert.NoError(t, hwrConfig{Behaviours: defaultBehaviours}.validate())
+	assert.Error(t, hwrConfig{Behaviours: []behaviour{{Code: "ts"}}}.validate())
+	assert.Error(t, hwrConfig{Behaviours: []behaviour{{Code: "t s", Name: "team spirit"}}}.validate())
+	assert.Error(t, hwrConfig{Behaviours: []behaviour{{Code: "ts", Name: "team spirit"}, {Code: "TS", Name: "top speed"}}}.validate())
+	assert.Error(t, hwrConfig{Behaviours: []behaviour{{Code: "ts", Name: "team spirit", Emoji: "zap"}, {Code: "rr", Name: "recognized reveller", Emoji: "zap"}}}.validate())
+}
+
+func TestWakeUp(t *testing.T) {
+	posted := make(map[string][]string)
+	ts := 0
+	dnd := &slack.DNDStatus{}
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("GetUserInfo", "U2").Return(&slack.User{RealName: "Ruskin"}, nil)
+	rtm.On("OpenIMChannel", mock.Anything).Return(func(user string) bool { return false }, func(user string) bool { return false },
+		func(user string) string { return "D" + user }, func(user string) error { return nil })
+	rtm.On("PostMessage", mock.Anything, mock.Anything, mock.Anything).Return(func(channel, text string, params slack.PostMessageParameters) string {
+		posted[channel] = append(posted[channel], text)
+		return channel
+	}, func(channel, text string, params slack.PostMessageParameters) string {
+		ts++
+		return strconv.Itoa(ts)
+	}, func(channel, text string, params slack.PostMessageParameters) error { return nil })
+	onSendMessage(rtm, func(channel, text string) { posted[channel] = append(posted[channel], text) })
+	rtm.On("GetDNDInfo", mock.Anything).Return(func(user *string) *slack.DNDStatus { return dnd }, nil)
+	rtm.On("GetUserPresence", mock.Anything).Return(&slack.UserPresence{Presence: "active"}, nil)
+
+	srv := server{slack: rtm, store: newStore(""), config: config{WakeUp: wakeUpConfig{NudgeMinutes: 5, Nudges: 2}}}
+	now := time.Date(2018, 9, 20, 0, 0, 0, 0, time.UTC)
+
+	resp, pinged, err := srv.wakeUp("U1", "C1", "wake up <@u2> The build is broken", now)
+	assert.NoError(t, err)
+	assert.True(t, pinged)
+	assert.Equal(t, "I've just pinged Ruskin for you :)", resp)
+	assert.Equal(t, ":wave: Buddy stop napping at work, <@U1> is looking for you in <#C1>: The build is broken\n"+
+		"React to this to let them know you're on it, or `snooze 30m` to stop wake ups for a bit", posted["DU2"][0])
+
+	// nothing until they've had 5 minutes, then it gets louder until we give up
+	assert.NoError(t, srv.nudgeWakeUps(now.Add(4*time.Minute)))
+	assert.Len(t, posted["DU2"], 1)
+	assert.NoError(t, srv.nudgeWakeUps(now.Add(5*time.Minute)))
+	assert.NoError(t, srv.nudgeWakeUps(now.Add(10*time.Minute)))
+	assert.Equal(t, ":rotating_light: <@U1> really needs you in <#C1>!", posted["DU2"][2])
+	assert.NoError(t, srv.nudgeWakeUps(now.Add(15*time.Minute)))
+	assert.Len(t, posted["DU2"], 3)
+	assert.Equal(t, []string{"<@U2> hasn't answered after 3 pings, you might have to go and find them"}, posted["DU1"])
+
+	// reacting to any of the pings stops them
+	srv.wakeUp("U1", "C1", "wake up <@U2>", now)
+	srv.nudgeWakeUps(now.Add(5 * time.Minute))
+	assert.NoError(t, srv.ackWakeUp("U2", "4"))
+	assert.Equal(t, "<@U2> is awake and on it :)", posted["DU1"][1])
+	srv.nudgeWakeUps(now.Add(10 * time.Minute))
+	assert.Len(t, posted["DU2"], 5)
+
+	// do not disturb holds the ping until it ends
+	dnd = &slack.DNDStatus{Enabled: true, NextStartTimestamp: int(now.Add(-time.Hour).Unix()), NextEndTimestamp: int(now.Add(time.Hour).Unix())}
+	resp, pinged, err = srv.wakeUp("U1", "C1", "wake up <@U2>", now)
+	assert.NoError(t, err)
+	assert.False(t, pinged)
+	assert.Equal(t, "Shh, Ruskin is on do not disturb until 1:00pm, I'll ping them then", resp)
+	assert.Len(t, posted["DU2"], 5)
+	dnd = &slack.DNDStatus{}
+	srv.nudgeWakeUps(now.Add(time.Hour))
+	assert.Len(t, posted["DU2"], 6)
+
+	// snoozing cancels what's going and stops new ones
+	resp, err = srv.snoozeWakeUps("U2", "snooze 30m", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, "No more wake ups until 1:30pm, unsnooze to turn them back on", resp)
+	assert.Equal(t, "<@U2> has snoozed wake ups until 1:30pm", posted["DU1"][2])
+	resp, pinged, err = srv.wakeUp("U1", "C1", "wake up <@U2>", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, pinged)
+	assert.Equal(t, "Sorry, Ruskin has snoozed wake ups until 1:30pm", resp)
+	srv.snoozeWakeUps("U2", "unsnooze", now.Add(time.Hour))
+	resp, _, _ = srv.wakeUp("U1", "C1", "wake up <@U2>", now.Add(time.Hour))
+	assert.Equal(t, "I've just pinged Ruskin for you :)", resp)
+
+	// nudges count towards the DM limits, and stop if they opt out
+	var audit []dmAudit
+	assert.NoError(t, srv.store.load(dmAuditKey, &audit))
+	assert.Len(t, audit, 4)
+	assert.Equal(t, dmAudit{Time: now.Add(time.Hour), Sender: "U1", Target: "U2", Command: "wake up"}, audit[3])
+	srv.optOutOfDMs("U2", "stop pinging me")
+	assert.NoError(t, srv.nudgeWakeUps(now.Add(time.Hour+5*time.Minute)))
+	assert.Len(t, posted["DU2"], 7)
+	assert.Equal(t, "I've stopped pinging <@U2>: Sorry, <@U2> has asked me not to DM them", posted["DU1"][3])
+	assert.NoError(t, srv.nudgeWakeUps(now.Add(time.Hour+10*time.Minute)))
+	assert.Len(t, posted["DU1"], 4)
+}
+
+func TestNudgeWakeUpsUnlocked(t *testing.T) {
+	var srv server
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("GetDNDInfo", mock.Anything).Return(&slack.DNDStatus{}, nil)
+	rtm.On("GetUserPresence", mock.Anything).Return(&slack.UserPresence{Presence: "active"}, nil)
+	// they react to the first ping while we're nudging them, which needs the store
+	rtm.On("PostMessage", "D2", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		assert.NoError(t, srv.ackWakeUp("U2", "1"))
+	}).Return("D2", "2", nil)
+	rtm.On("OpenIMChannel", mock.Anything).Return(false, false, "D1", nil)
+	var sent []string
+	onSendMessage(rtm, func(channel, text string) { sent = append(sent, text) })
+
+	srv = server{slack: rtm, store: newStore("")}
+	now := time.Date(2018, 9, 20, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, srv.addWakeUp(&pendingWakeUp{Target: "U2", Requester: "U1", Channel: "C1", IM: "D2", Pings: []string{"1"}, Next: now}))
+	assert.NoError(t, srv.addWakeUp(&pendingWakeUp{Target: "U3", Requester: "U1", Channel: "C1", Next: now.Add(time.Hour)}))
+
+	assert.NoError(t, srv.nudgeWakeUps(now))
+	assert.Equal(t, []string{"<@U2> is awake and on it :)"}, sent)
+	var wakeUps []*pendingWakeUp
+	assert.NoError(t, srv.store.load(wakeUpsKey, &wakeUps))
+	assert.Len(t, wakeUps, 1)
+	assert.Equal(t, "U3", wakeUps[0].Target)
+}
+
+func TestSnoozeInDM(t *testing.T) {
+	now := time.Date(2018, 9, 20, 0, 0, 0, 0, time.UTC)
+	srv := server{store: newStore(""), sched: newScheduler(mockClock{t: now})}
+	info := &slack.Info{User: &slack.UserDetails{ID: "BOT"}}
+
+	// replying to a wake up, no need to mention us
+	msg := &slack.MessageEvent{Msg: slack.Msg{User: "U2", Channel: "DU2", Text: "Snooze 30m"}}
+	resp, err := srv.processMessage(msg, info, "<@BOT> ", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "No more wake ups until 12:30pm, unsnooze to turn them back on", resp)
+
+	msg.Text = "unsnooze"
+	resp, err = srv.processMessage(msg, info, "<@BOT> ", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Wake ups are back on", resp)
+
+	// things like standup answers that happen to start with snooze aren't for us
+	for _, text := range []string{"Snoozed the flaky alert, fixing it today", "snooze the alerts until friday"} {
+		msg.Text = text
+		resp, err = srv.processMessage(msg, info, "<@BOT> ", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "", resp)
+	}
+	snoozes := make(map[string]time.Time)
+	assert.NoError(t, srv.store.load(wakeUpSnoozesKey, &snoozes))
+	assert.Empty(t, snoozes)
+	assert.True(t, isSnoozeReply("snooze wake ups for 2h"))
+	assert.True(t, isSnoozeReply("snooze"))
+}
+
+func TestGuardDMs(t *testing.T) {
+	srv := server{store: newStore(""), config: config{DMs: dmsConfig{SenderPerHour: 3, TargetPerHour: 2}}}
+	now := time.Date(2018, 9, 20, 0, 0, 0, 0, time.UTC)
+	runs := 0
+	dm := func(dmed ...string) func() (string, []string, error) {
+		return func() (string, []string, error) {
+			runs++
+			return "sent", dmed, nil
+		}
+	}
+
+	resp, err := srv.guardDMs("U1", "wake up", []string{"U2"}, now, dm("U2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "sent", resp)
+	srv.guardDMs("U1", "wake up", []string{"U2"}, now, dm("U2"))
+	resp, _ = srv.guardDMs("U3", "wake up", []string{"U2"}, now, dm("U2"))
+	assert.Equal(t, "<@U2> has had enough DMs from me for now, try again later", resp)
+	resp, _ = srv.guardDMs("U1", "hwr", []string{"U3", "U4"}, now, dm("U3", "U4"))
+	assert.Equal(t, "Easy tiger, you've had me send 2 DMs in the last hour, try again later", resp)
+	assert.Equal(t, 2, runs)
+
+	// only the people who actually got a DM count
+	resp, _ = srv.guardDMs("U1", "wake up", []string{"U4"}, now, dm())
+	assert.Equal(t, "sent", resp)
+	resp, _ = srv.guardDMs("U1", "wake up", []string{"U4"}, now, dm("U4"))
+	assert.Equal(t, "sent", resp)
+
+	// an hour later they're free to go again, and DMing yourself doesn't count
+	resp, _ = srv.guardDMs("U1", "hwr", []string{"U3", "U4", "U1"}, now.Add(time.Hour), dm("U3", "U4", "U1"))
+	assert.Equal(t, "sent", resp)
+
+	resp, err = srv.optOutOfDMs("U4", "stop pinging me")
+	assert.NoError(t, err)
+	assert.Equal(t, "Okay, I won't DM you when people ask me to. Say start pinging me if you change your mind", resp)
+	resp, _ = srv.guardDMs("U5", "wake up", []string{"U4"}, now.Add(2*time.Hour), dm("U4"))
+	assert.Equal(t, "Sorry, <@U4> has asked me not to DM them", resp)
+	srv.optOutOfDMs("U4", "start pinging me")
+	resp, _ = srv.guardDMs("U5", "wake up", []string{"U4"}, now.Add(2*time.Hour), dm("U4"))
+	assert.Equal(t, "sent", resp)
+
+	var audit []dmAudit
+	assert.NoError(t, srv.store.load(dmAuditKey, &audit))
+	assert.Len(t, audit, 6)
+	assert.Equal(t, dmAudit{Time: now, Sender: "U1", Target: "U4", Command: "wake up"}, audit[2])
+	assert.Equal(t, dmAudit{Time: now.Add(2 * time.Hour), Sender: "U5", Target: "U4", Command: "wake up"}, audit[5])
+}
+
+func TestPickUser(t *testing.T) {
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("GetInfo").Return(&slack.Info{User: &slack.UserDetails{ID: "BOT"}})
+	rtm.On("GetUsersInConversation", &slack.GetUsersInConversationParameters{ChannelID: "G1", Limit: 200}).Return([]string{"BOT", "U1", "U2"}, "next", nil)
+	rtm.On("GetUsersInConversation", &slack.GetUsersInConversationParameters{ChannelID: "G1", Limit: 200, Cursor: "next"}).Return([]string{"U3", "U4"}, "", nil)
+	rtm.On("GetUsersInConversation", &slack.GetUsersInConversationParameters{ChannelID: "C2", Limit: 200}).Return([]string{}, "", nil)
+	rtm.On("GetUsers").Return([]slack.User{
+		{ID: "BOT", RealName: "Rudolph", IsBot: true},
+		{ID: "U1", RealName: "Ruskin"},
+		{ID: "U2", RealName: "Standup Bot", IsBot: true},
+		{ID: "U3", RealName: "Dhruv"},
+		{ID: "U4", RealName: "Gone", Deleted: true},
+		{ID: "U5", RealName: "Elsewhere"},
+	}, nil)
+
+	srv := server{slack: rtm, store: newStore("")}
+
+	// only Ruskin and Dhruv count, and they take turns
+	first, err := srv.pickUser("G1", "who's buying coffee")
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"Ruskin", "Dhruv"}, first)
+	for i := 0; i < 5; i++ {
+		next, err := srv.pickUser("G1", "who's buying coffee")
+		assert.NoError(t, err)
+		assert.NotEqual(t, first, next)
+		first = next
+	}
+
+	resp, err := srv.pickUser("C2", "who's buying coffee")
+	assert.NoError(t, err)
+	assert.Equal(t, "There's nobody here I can pick", resp)
+
+	resp, err = srv.pickUser("C2", "who of <@u3> <@U2>")
+	assert.NoError(t, err)
+	assert.Equal(t, "Dhruv", resp)
+	// one lookup of the team each time, not one per person
+	rtm.AssertNumberOfCalls(t, "GetUsers", 8)
+	rtm.AssertNotCalled(t, "GetUserInfo", mock.Anything)
+
+	// and with a cache, only once until it goes stale
+	now := time.Date(2018, 9, 20, 0, 0, 0, 0, time.UTC)
+	srv.users = newUserCache(mockClock{t: now}, time.Minute)
+	srv.pickUser("G1", "who's buying coffee")
+	srv.pickUser("C2", "who of <@u3> <@U2>")
+	rtm.AssertNumberOfCalls(t, "GetUsers", 9)
+	srv.users.clock = mockClock{t: now.Add(time.Minute)}
+	srv.pickUser("G1", "who's buying coffee")
+	rtm.AssertNumberOfCalls(t, "GetUsers", 10)
+}
+
+func TestWeightedPick(t *testing.T) {
+	assert.Equal(t, "U1", weightedPick([]string{"U1"}, []string{"U1"}))
+	// U3 has never been picked, U2 was picked just now
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		counts[weightedPick([]string{"U1", "U2", "U3"}, []string{"U1", "U2"})]++
+	}
+	assert.Zero(t, counts["U2"])
+	assert.True(t, counts["U3"] > counts["U1"])
+}
+
+func TestRotation(t *testing.T) {
+	var sent []string
+	rtm := new(mocks.SlackRTMInterface)
+	onSendMessage(rtm, func(channel, text string) { sent = append(sent, channel+": "+text) })
+
+	srv := server{slack: rtm, store: newStore("")}
+	now := time.Date(2018, 9, 17, 0, 0, 0, 0, time.UTC)
+	cmd := func(text string) string {
+		resp, err := srv.rotationCommand("C1", text, now)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, "Created standup-host: <@U1>, <@U2>, <@U3>, rotation next standup-host to get started", cmd("rotation create standup-host <@u1> <@u2> <@u3>"))
+	assert.Equal(t, "There's already a rotation called standup-host", cmd("rotation create standup-host <@u1>"))
+	assert.Equal(t, "<@U1> is up for standup-host", cmd("rotation next standup-host"))
+	assert.Equal(t, "<@U2> is up for standup-host instead, <@U1> is next", cmd("rotation skip standup-host"))
+	assert.Equal(t, "<@U1> is up for standup-host", cmd("rotation next standup-host"))
+	assert.Equal(t, "Done, <@U1> and <@U3> have swapped\nstandup-host: <@U2>, *<@U3>*, <@U1>", cmd("rotation swap standup-host <@u1> <@u3>"))
+	assert.Equal(t, "<@U1> is up for standup-host", cmd("rotation next standup-host"))
+	assert.Equal(t, "Who's been up for standup-host:\n"+
+		"Mon 17 Sep <@U1>\nMon 17 Sep <@U3> (swapped <@U1> and <@U3>)\nMon 17 Sep <@U1>\n"+
+		"Mon 17 Sep <@U2> (skipped <@U1>)\nMon 17 Sep <@U1>", cmd("rotation history standup-host"))
+	assert.Equal(t, "There isn't a rotation called nope, try rotation create nope @ruskin.dantra @dhruv", cmd("rotation next nope"))
+
+	// only weekly rotations move on by themselves
+	assert.Equal(t, "Created reviewer: <@U4>, <@U5> (weekly), I'll announce who's up every Monday morning", cmd("rotation create reviewer <@u4> <@u5> weekly"))
+	assert.NoError(t, srv.announceRotations(now))
+	assert.NoError(t, srv.announceRotations(now.AddDate(0, 0, 7)))
+	assert.Equal(t, []string{"C1: :calendar: <@U4> is up for reviewer this week", "C1: :calendar: <@U5> is up for reviewer this week"}, sent)
+	assert.Equal(t, "reviewer: <@U4>, *<@U5>* (weekly)\nstandup-host: <@U2>, <@U3>, *<@U1>*", cmd("rotations"))
+}
+
+func TestStandup(t *testing.T) {
+	sent := make(map[string][]string)
+	rtm := new(mocks.SlackRTMInterface)
+	rtm.On("GetInfo").Return(&slack.Info{User: &slack.UserDetails{ID: "BOT"}})
+	rtm.On("GetUsersInConversation", mock.Anything).Return([]string{"BOT", "U1", "U2", "U3"}, "", nil)
+	rtm.On("GetUsers").Return([]slack.User{
+		{ID: "U1", RealName: "Ruskin"},
+		{ID: "U2", RealName: "Dhruv"},
+		{ID: "U3", RealName: "Jira", IsBot: true},
+	}, nil)
+	rtm.On("OpenIMChannel", mock.Anything).Return(func(user string) bool { return false }, func(user string) bool { return false },
+		func(user string) string { return "D" + user }, func(user string) error { return nil })
+	onSendMessage(rtm, func(channel, text string) { sent[channel] = append(sent[channel], text) })
+
+	srv := server{slack: rtm, store: newStore("")}
+	nz := loadLocation("Pacific/Auckland")
+	// a thursday
+	now := time.Date(2018, 9, 20, 9, 30, 0, 0, nz)
+	cmd := func(text string) string {
+		resp, err := srv.standupCommand("U9", "C1", text, now)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, "Got it, 2 questions, now tell me when with standup at 9:30am", cmd("standup questions What did you do? | Any blockers?"))
+	assert.Equal(t, "Standup is at 09:30 on weekdays, I'll DM everyone the questions and post the answers here", cmd("standup at 9:30am until 10:30am"))
+	assert.Equal(t, "Standup is at 09:30 Pacific/Auckland on weekdays, the answers get posted at 10:30\nEveryone in the channel gets asked:\nWhat did you do?\nAny blockers?", cmd("standup"))
+
+	// it doesn't start until 9:30
+	assert.NoError(t, srv.runStandups(now.Add(-time.Minute)))
+	assert.Empty(t, sent)
+	assert.NoError(t, srv.runStandups(now))
+	assert.NoError(t, srv.runStandups(now.Add(30*time.Second)))
+	assert.Equal(t, []string{"It's standup time for <#C1>! I'll post your answers there at 10:30am\nWhat did you do?"}, sent["DU1"])
+	assert.Len(t, sent["DU2"], 1)
+	assert.Empty(t, sent["DU3"])
+
+	resp, ok, err := srv.standupAnswer("U1", "DU1", "Fixed the build")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "Any blockers?", resp)
+	resp, _, _ = srv.standupAnswer("U1", "DU1", "Nope")
+	assert.Equal(t, "Thanks! That's all for <#C1>", resp)
+	_, ok, _ = srv.standupAnswer("U1", "DU1", "Anything else?")
+	assert.False(t, ok)
+
+	// only Dhruv gets nudged halfway through
+	assert.NoError(t, srv.runStandups(now.Add(30*time.Minute)))
+	assert.Len(t, sent["DU1"], 1)
+	assert.Equal(t, "Don't forget standup for <#C1>, I'm posting the answers at 10:30am\nWhat did you do?", sent["DU2"][1])
+
+	assert.NoError(t, srv.runStandups(now.Add(time.Hour)))
+	assert.Equal(t, []string{":memo: Standup for Thursday 20 September\n\n<@U1>\n*What did you do?*\nFixed the build\n*Any blockers?*\nNope\n\nNo update from <@U2>"}, sent["C1"])
+	_, ok, _ = srv.standupAnswer("U2", "DU2", "Too late")
+	assert.False(t, ok)
+
+	// not on the weekend
+	assert.NoError(t, srv.runStandups(now.AddDate(0, 0, 2)))
+	assert.Len(t, sent["DU1"], 1)
+
+	// people who opted out of DMs aren't asked, and there's only one standup at a time
+	srv.optOutOfDMs("U2", "stop pinging me")
+	assert.Equal(t, "I've asked 1 person, answers at 10:30am", cmd("standup now"))
+	assert.Equal(t, "Standup is already going, I'll post the answers at 10:30am", cmd("standup now"))
+	assert.Len(t, sent["DU1"], 2)
+	assert.Len(t, sent["DU2"], 2)
+
+	// the scheduled ones are down to the channel, and standup now to whoever asked
+	var audit []dmAudit
+	assert.NoError(t, srv.store.load(dmAuditKey, &audit))
+	var senders []string
+	for _, a := range audit {
+		senders = append(senders, a.Sender+" "+a.Target)
+	}
+	assert.Equal(t, []string{"C1 U1", "C1 U2", "U9 U1"}, senders)
+
+	// and standup now counts towards their DM limit
+	srv.config.DMs.SenderPerHour = 1
+	srv.store.save(standupRunsKey, map[string]*standupRun{})
+	srv.optOutOfDMs("U2", "start pinging me")
+	assert.Equal(t, "Easy tiger, you've had me send 1 DMs in the last hour, try again later", cmd("standup now"))
+	assert.Len(t, sent["DU1"], 2)
+}
+
 /*
 type testTrelloClient struct {
 	unhappyPath      bool
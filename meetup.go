@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// meetupEvent - the bits of a meetup.com event we put on the board
+type meetupEvent struct {
+	Name         string       `json:"name"`
+	LocalDate    string       `json:"local_date"`
+	LocalTime    string       `json:"local_time"`
+	UTCOffset    int          `json:"utc_offset"`
+	Link         string       `json:"link"`
+	YesRSVPCount int          `json:"yes_rsvp_count"`
+	Venue        *meetupVenue `json:"venue"`
+}
+
+type meetupVenue struct {
+	Name     string `json:"name"`
+	Address1 string `json:"address_1"`
+	City     string `json:"city"`
+}
+
+type meetupClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+var meetupEventID = regexp.MustCompile(`^[a-z0-9]+$`)
+
+func newMeetupClient(client *http.Client) *meetupClient {
+	return &meetupClient{client: client, baseURL: "https://api.meetup.com"}
+}
+
+// parseMeetupURL pulls the group and event out of a meetup link, with or
+// without slack's <url|label> formatting, eg. https://www.meetup.com/golang-nz/events/254375678/
+func parseMeetupURL(link string) (string, string, error) {
+	link = strings.TrimPrefix(strings.TrimSpace(link), "<")
+	link = strings.TrimSuffix(link, ">")
+	if i := strings.Index(link, "|"); i != -1 {
+		link = link[:i]
+	}
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "Could not parse meetup link: %s", link)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host != "meetup.com" && !strings.HasSuffix(host, ".meetup.com") {
+		return "", "", errors.Errorf("Not a meetup link: %s", link)
+	}
+
+	// links can have a locale in front, eg. /en-AU/golang-nz/events/254375678/
+	parts := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	for i := 1; i+1 < len(parts); i++ {
+		if parts[i] == "events" && meetupEventID.MatchString(strings.ToLower(parts[i+1])) {
+			return parts[i-1], parts[i+1], nil
+		}
+	}
+	return "", "", errors.Errorf("Could not find an event in meetup link: %s", link)
+}
+
+func (m *meetupClient) getEvent(group, eventID string) (meetupEvent, error) {
+	var e meetupEvent
+	u := fmt.Sprintf("%s/%s/events/%s", m.baseURL, url.PathEscape(group), url.PathEscape(eventID))
+
+	err := m.get(u, &e)
+	if err != nil {
+		return e, err
+	}
+	return e, e.validate(u)
+}
+
+// upcomingEvents skips any events meetup gives us without a name or date
+func (m *meetupClient) upcomingEvents(group string) ([]meetupEvent, error) {
+	var events []meetupEvent
+	u := fmt.Sprintf("%s/%s/events?status=upcoming&page=20", m.baseURL, url.PathEscape(group))
+
+	err := m.get(u, &events)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []meetupEvent
+	for _, e := range events {
+		if err := e.validate(u); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			continue
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+func (m *meetupClient) get(u string, v interface{}) error {
+	resp, err := m.client.Get(u)
+	if err != nil {
+		return errors.Wrapf(err, "Could not make request to %s", u)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return errors.Wrapf(err, "Could not read request for %s", u)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Meetup returned %d for %s", resp.StatusCode, u)
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return errors.Wrapf(err, "Could not deserialise meetup response from %s", u)
+	}
+	return nil
+}
+
+func (e meetupEvent) validate(u string) error {
+	if e.Name == "" {
+		return errors.Errorf("Meetup event from %s has no name", u)
+	}
+	_, err := e.start()
+	return err
+}
+
+// start is the local date and time in the timezone meetup says the event is in
+func (e meetupEvent) start() (time.Time, error) {
+	loc := time.FixedZone("", e.UTCOffset/1000)
+
+	if e.LocalTime == "" {
+		t, err := time.ParseInLocation("2006-01-02", e.LocalDate, loc)
+		return t, errors.Wrapf(err, "Could not parse meetup date: %s", e.LocalDate)
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", e.LocalDate+" "+e.LocalTime, loc)
+	return t, errors.Wrapf(err, "Could not parse meetup date: %s %s", e.LocalDate, e.LocalTime)
+}
+
+func (e meetupEvent) description() string {
+	var d strings.Builder
+	if e.Venue != nil {
+		venue := e.Venue.Name
+		for _, p := range []string{e.Venue.Address1, e.Venue.City} {
+			if p != "" {
+				venue += ", " + p
+			}
+		}
+		d.WriteString("Venue: " + venue + "\n")
+	}
+	d.WriteString("Going: " + strconv.Itoa(e.YesRSVPCount) + "\n")
+	d.WriteString(e.Link)
+	return d.String()
+}
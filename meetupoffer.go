@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+const (
+	meetupOffersKey = "meetup_offers"
+	confirmReaction = "+1"
+)
+
+// meetupOffer - meetup links someone shared that we've asked about adding
+type meetupOffer struct {
+	Channel string   `json:"channel"`
+	Source  string   `json:"source"`
+	Links   []string `json:"links"`
+	Added   bool     `json:"added"`
+}
+
+var slackLink = regexp.MustCompile(`<([^<>|]+)(?:\|[^<>]*)?>`)
+var plainMeetupLink = regexp.MustCompile(`https?://(?:[a-z]+\.)?meetup\.com/[^\s<>|]+`)
+
+// meetupLinks finds links to meetup events anywhere in a message, including
+// the attachments slack adds when it unfurls them
+func meetupLinks(text string, attachments []slack.Attachment) []string {
+	var candidates []string
+	for _, m := range slackLink.FindAllStringSubmatch(text, -1) {
+		candidates = append(candidates, m[1])
+	}
+	for _, a := range attachments {
+		candidates = append(candidates, a.TitleLink)
+		candidates = append(candidates, plainMeetupLink.FindAllString(a.Text, -1)...)
+	}
+
+	var links []string
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		group, id, err := parseMeetupURL(c)
+		if err != nil {
+			continue
+		}
+		key := strings.ToLower(group + "/" + id)
+		if !seen[key] {
+			seen[key] = true
+			links = append(links, c)
+		}
+	}
+	return links
+}
+
+// offerMeetups asks whether to add meetups someone mentioned in passing,
+// unfurls arrive as an edit so we only ask about links we haven't already
+func (s *server) offerMeetups(channel, source string, links []string) error {
+	if len(links) == 0 {
+		return nil
+	}
+
+	offers := make(map[string]*meetupOffer)
+	err := s.store.load(meetupOffersKey, &offers)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range offers {
+		if o.Channel == channel && o.Source == source {
+			for _, l := range o.Links {
+				links = removeString(links, l)
+			}
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	text := "Looks like you shared a meetup: " + links[0] + "\nReact with :" + confirmReaction + ": and I'll add it to the trello board"
+	if len(links) > 1 {
+		text = "Looks like you shared some meetups:\n" + strings.Join(links, "\n") + "\nReact with :" + confirmReaction + ": and I'll add them to the trello board"
+	}
+
+	_, ts, err := s.slack.PostMessage(channel, text, slack.PostMessageParameters{AsUser: true, UnfurlLinks: false})
+	if err != nil {
+		return errors.Wrap(err, "Could not offer to add meetups")
+	}
+	err = s.slack.AddReaction(confirmReaction, slack.NewRefToMessage(channel, ts))
+	if err != nil {
+		fmt.Printf("Error: Could not add %s to meetup offer: %s\n", confirmReaction, err)
+	}
+
+	return s.store.update(meetupOffersKey, &offers, func() error {
+		pruneOffers(offers, time.Now().Add(-7*24*time.Hour))
+		offers[ts] = &meetupOffer{Channel: channel, Source: source, Links: links}
+		return nil
+	})
+}
+
+// confirmMeetups adds the meetups from an offer once someone reacts to it.
+// Each link comes off the offer once it's on the board, so if trello or
+// meetup fail another thumbs up tries the rest again
+func (s *server) confirmMeetups(client *http.Client, reaction, ts string) error {
+	if reaction != confirmReaction {
+		return nil
+	}
+
+	offers := make(map[string]*meetupOffer)
+	err := s.store.load(meetupOffersKey, &offers)
+	if err != nil {
+		return err
+	}
+	offer, ok := offers[ts]
+	if !ok || offer.Added {
+		return nil
+	}
+
+	for _, l := range offer.Links {
+		resp, err := s.addMeetup(client, l, offer.Channel)
+		if err != nil {
+			return err
+		}
+		current := make(map[string]*meetupOffer)
+		err = s.store.update(meetupOffersKey, &current, func() error {
+			if o, ok := current[ts]; ok {
+				var left []string
+				for _, link := range o.Links {
+					if link != l {
+						left = append(left, link)
+					}
+				}
+				o.Links = left
+				o.Added = len(left) == 0
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if resp != "" {
+			s.slack.SendMessage(s.slack.NewOutgoingMessage(resp, offer.Channel))
+		}
+	}
+	return nil
+}
+
+// pruneOffers forgets offers from before cutoff, message timestamps are unix seconds
+func pruneOffers(offers map[string]*meetupOffer, cutoff time.Time) {
+	for ts := range offers {
+		sec, err := strconv.ParseFloat(ts, 64)
+		if err == nil && time.Unix(int64(sec), 0).Before(cutoff) {
+			delete(offers, ts)
+		}
+	}
+}
@@ -10,22 +10,36 @@ type SlackRTMInterface struct {
 	mock.Mock
 }
 
-// GetChannelInfo provides a mock function with given fields: channelID
-func (_m *SlackRTMInterface) GetChannelInfo(channelID string) (*slack.Channel, error) {
-	ret := _m.Called(channelID)
+// AddReaction provides a mock function with given fields: name, item
+func (_m *SlackRTMInterface) AddReaction(name string, item slack.ItemRef) error {
+	ret := _m.Called(name, item)
 
-	var r0 *slack.Channel
-	if rf, ok := ret.Get(0).(func(string) *slack.Channel); ok {
-		r0 = rf(channelID)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, slack.ItemRef) error); ok {
+		r0 = rf(name, item)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetDNDInfo provides a mock function with given fields: user
+func (_m *SlackRTMInterface) GetDNDInfo(user *string) (*slack.DNDStatus, error) {
+	ret := _m.Called(user)
+
+	var r0 *slack.DNDStatus
+	if rf, ok := ret.Get(0).(func(*string) *slack.DNDStatus); ok {
+		r0 = rf(user)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*slack.Channel)
+			r0 = ret.Get(0).(*slack.DNDStatus)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(channelID)
+	if rf, ok := ret.Get(1).(func(*string) error); ok {
+		r1 = rf(user)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -88,6 +102,82 @@ func (_m *SlackRTMInterface) GetUserInfo(user string) (*slack.User, error) {
 	return r0, r1
 }
 
+// GetUserPresence provides a mock function with given fields: user
+func (_m *SlackRTMInterface) GetUserPresence(user string) (*slack.UserPresence, error) {
+	ret := _m.Called(user)
+
+	var r0 *slack.UserPresence
+	if rf, ok := ret.Get(0).(func(string) *slack.UserPresence); ok {
+		r0 = rf(user)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*slack.UserPresence)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(user)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUsers provides a mock function with given fields:
+func (_m *SlackRTMInterface) GetUsers() ([]slack.User, error) {
+	ret := _m.Called()
+
+	var r0 []slack.User
+	if rf, ok := ret.Get(0).(func() []slack.User); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]slack.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUsersInConversation provides a mock function with given fields: params
+func (_m *SlackRTMInterface) GetUsersInConversation(params *slack.GetUsersInConversationParameters) ([]string, string, error) {
+	ret := _m.Called(params)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(*slack.GetUsersInConversationParameters) []string); ok {
+		r0 = rf(params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 string
+	if rf, ok := ret.Get(1).(func(*slack.GetUsersInConversationParameters) string); ok {
+		r1 = rf(params)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(*slack.GetUsersInConversationParameters) error); ok {
+		r2 = rf(params)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // NewOutgoingMessage provides a mock function with given fields: text, channelID, options
 func (_m *SlackRTMInterface) NewOutgoingMessage(text string, channelID string, options ...slack.RTMsgOption) *slack.OutgoingMessage {
 	_va := make([]interface{}, len(options))
@@ -146,7 +236,58 @@ func (_m *SlackRTMInterface) OpenIMChannel(user string) (bool, bool, string, err
 	return r0, r1, r2, r3
 }
 
+// PostMessage provides a mock function with given fields: channel, text, params
+func (_m *SlackRTMInterface) PostMessage(channel string, text string, params slack.PostMessageParameters) (string, string, error) {
+	ret := _m.Called(channel, text, params)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string, string, slack.PostMessageParameters) string); ok {
+		r0 = rf(channel, text, params)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 string
+	if rf, ok := ret.Get(1).(func(string, string, slack.PostMessageParameters) string); ok {
+		r1 = rf(channel, text, params)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string, string, slack.PostMessageParameters) error); ok {
+		r2 = rf(channel, text, params)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // SendMessage provides a mock function with given fields: msg
 func (_m *SlackRTMInterface) SendMessage(msg *slack.OutgoingMessage) {
 	_m.Called(msg)
 }
+
+// UploadFile provides a mock function with given fields: params
+func (_m *SlackRTMInterface) UploadFile(params slack.FileUploadParameters) (*slack.File, error) {
+	ret := _m.Called(params)
+
+	var r0 *slack.File
+	if rf, ok := ret.Get(0).(func(slack.FileUploadParameters) *slack.File); ok {
+		r0 = rf(params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*slack.File)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(slack.FileUploadParameters) error); ok {
+		r1 = rf(params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
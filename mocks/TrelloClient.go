@@ -24,6 +24,43 @@ func (_m *TrelloClient) CreateCard(card *trello.Card, extraArgs trello.Arguments
 	return r0
 }
 
+// CreateWebhook provides a mock function with given fields: webhook
+func (_m *TrelloClient) CreateWebhook(webhook *trello.Webhook) error {
+	ret := _m.Called(webhook)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*trello.Webhook) error); ok {
+		r0 = rf(webhook)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetCard provides a mock function with given fields: cardID, args
+func (_m *TrelloClient) GetCard(cardID string, args trello.Arguments) (*trello.Card, error) {
+	ret := _m.Called(cardID, args)
+
+	var r0 *trello.Card
+	if rf, ok := ret.Get(0).(func(string, trello.Arguments) *trello.Card); ok {
+		r0 = rf(cardID, args)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*trello.Card)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, trello.Arguments) error); ok {
+		r1 = rf(cardID, args)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetList provides a mock function with given fields: listID, args
 func (_m *TrelloClient) GetList(listID string, args trello.Arguments) (*trello.List, error) {
 	ret := _m.Called(listID, args)
@@ -46,3 +83,26 @@ func (_m *TrelloClient) GetList(listID string, args trello.Arguments) (*trello.L
 
 	return r0, r1
 }
+
+// GetToken provides a mock function with given fields: tokenID, args
+func (_m *TrelloClient) GetToken(tokenID string, args trello.Arguments) (*trello.Token, error) {
+	ret := _m.Called(tokenID, args)
+
+	var r0 *trello.Token
+	if rf, ok := ret.Get(0).(func(string, trello.Arguments) *trello.Token); ok {
+		r0 = rf(tokenID, args)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*trello.Token)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, trello.Arguments) error); ok {
+		r1 = rf(tokenID, args)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
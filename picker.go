@@ -0,0 +1,182 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+const (
+	picksKey = "picks"
+
+	// how many picks we remember in each channel
+	pickHistory = 100
+
+	// how long we keep the team's users before asking slack again
+	userCacheTTL = 15 * time.Minute
+)
+
+// userCache - the whole team's users, which slack is slow to give us on big
+// teams. People joining or leaving can wait for the ttl
+type userCache struct {
+	clock clock
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	users   []slack.User
+	fetched time.Time
+}
+
+func newUserCache(clock clock, ttl time.Duration) *userCache {
+	return &userCache{clock: clock, ttl: ttl}
+}
+
+// get asks slack for the users if we don't have them or they're stale,
+// without a cache it always asks
+func (c *userCache) get(api SlackRTMInterface) ([]slack.User, error) {
+	if c == nil {
+		return api.GetUsers()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.users != nil && c.clock.Now().Sub(c.fetched) < c.ttl {
+		return c.users, nil
+	}
+	users, err := api.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	c.users, c.fetched = users, c.clock.Now()
+	return users, nil
+}
+
+// pickUser handles eg. who's buying coffee and who of <@U1> <@U2> <@U3>.
+// It only picks real people, and weights it towards whoever has gone the
+// longest without being picked so nobody gets picked twice in a row
+func (s *server) pickUser(channel, text string) (string, error) {
+	words := strings.Fields(text)
+	var candidates []string
+	if len(words) > 1 && strings.ToLower(words[1]) == "of" {
+		candidates, _ = parseMentions(words[2:])
+		if len(candidates) == 0 {
+			return "Tell me who to pick from, eg. who of @ruskin.dantra @dhruv", nil
+		}
+	} else {
+		members, err := s.conversationMembers(channel)
+		if err != nil {
+			return "", err
+		}
+		candidates = members
+	}
+
+	people, err := s.people(candidates)
+	if err != nil {
+		return "", err
+	}
+	if len(people) == 0 {
+		return "There's nobody here I can pick", nil
+	}
+	var ids []string
+	names := make(map[string]string)
+	for _, u := range people {
+		ids = append(ids, u.ID)
+		names[u.ID] = u.RealName
+	}
+
+	var picked string
+	picks := make(map[string][]string)
+	err = s.store.update(picksKey, &picks, func() error {
+		picked = weightedPick(ids, picks[channel])
+		picks[channel] = append(picks[channel], picked)
+		if len(picks[channel]) > pickHistory {
+			picks[channel] = picks[channel][len(picks[channel])-pickHistory:]
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return names[picked], nil
+}
+
+// people looks up everyone in ids, leaving out rudolph, other bots and
+// deactivated accounts. It gets the whole team in one go rather than
+// asking slack about each of them
+func (s *server) people(ids []string) ([]*slack.User, error) {
+	users, err := s.users.get(s.slack)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get the team's users")
+	}
+	byID := make(map[string]*slack.User)
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+
+	var people []*slack.User
+	seen := make(map[string]bool)
+	bot := s.slack.GetInfo().User.ID
+	for _, id := range ids {
+		u, ok := byID[id]
+		if !ok || id == bot || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if u.IsBot || u.Deleted || u.ID == "USLACKBOT" {
+			continue
+		}
+		people = append(people, u)
+	}
+	return people, nil
+}
+
+// weightedPick weights everyone by how many picks there have been since
+// they were last picked, people who haven't been picked at all count as
+// though they were picked before everything in history
+func weightedPick(ids, history []string) string {
+	weights := make([]int, len(ids))
+	total := 0
+	for i, id := range ids {
+		weights[i] = len(history) + 1
+		for j := len(history) - 1; j >= 0; j-- {
+			if history[j] == id {
+				weights[i] = len(history) - 1 - j
+				break
+			}
+		}
+		total += weights[i]
+	}
+	if total == 0 {
+		return ids[rand.Intn(len(ids))]
+	}
+
+	n := rand.Intn(total)
+	for i, w := range weights {
+		if n < w {
+			return ids[i]
+		}
+		n -= w
+	}
+	return ids[len(ids)-1]
+}
+
+// conversationMembers works for channels, private channels and group DMs
+func (s *server) conversationMembers(channel string) ([]string, error) {
+	var members []string
+	params := &slack.GetUsersInConversationParameters{ChannelID: channel, Limit: 200}
+	for {
+		page, cursor, err := s.slack.GetUsersInConversation(params)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not get the members of: %s", channel)
+		}
+		members = append(members, page...)
+		if cursor == "" {
+			return members, nil
+		}
+		params.Cursor = cursor
+	}
+}
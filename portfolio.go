@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	portfoliosKey = "portfolios"
+
+	defaultPortfolioCurrency = "NZD"
+)
+
+// holding - some shares someone owns, Cost is the average price per share
+// they paid in the share's currency
+type holding struct {
+	Symbol   string  `json:"symbol"`
+	Shares   float64 `json:"shares"`
+	Cost     float64 `json:"cost"`
+	Currency string  `json:"currency"`
+}
+
+// portfolio handles eg.
+//
+//	portfolio add 100 atm nzx @ 3.20
+//	portfolio remove atm nzx
+//	portfolio
+//	portfolio aud
+func (s *server) portfolio(user, text string) (string, error) {
+	words := strings.Fields(strings.TrimPrefix(text, "portfolio"))
+	switch {
+	case len(words) == 0:
+		return s.showPortfolio(user, defaultPortfolioCurrency)
+	case len(words) == 1 && (words[0] == "nzd" || words[0] == "aud"):
+		return s.showPortfolio(user, strings.ToUpper(words[0]))
+	case words[0] == "add":
+		return s.addHolding(user, words[1:])
+	case words[0] == "remove":
+		return s.removeHolding(user, strings.Join(words[1:], " "))
+	}
+	return "Try portfolio add 100 atm nzx @ 3.20, portfolio, portfolio aud or portfolio remove atm nzx", nil
+}
+
+func (s *server) addHolding(user string, words []string) (string, error) {
+	// 100 atm nzx @ 3.20
+	at := -1
+	for i, w := range words {
+		if w == "@" || w == "at" {
+			at = i
+		}
+	}
+	if at < 2 || at != len(words)-2 {
+		return "Tell me how many, what and what you paid, eg. portfolio add 100 atm nzx @ 3.20", nil
+	}
+	shares, err := strconv.ParseFloat(words[0], 64)
+	if err != nil || shares <= 0 {
+		return "I don't know how many shares " + words[0] + " is", nil
+	}
+	cost, err := strconv.ParseFloat(strings.TrimPrefix(words[at+1], "$"), 64)
+	if err != nil || cost <= 0 {
+		return "I don't know what " + words[at+1] + " is, try something like 3.20", nil
+	}
+	symbol := strings.Join(words[1:at], " ")
+
+	q, err := s.quotes.Quote(symbol)
+	if isSymbolNotFound(err) {
+		return "I couldn't find a share called " + symbol + ", try something like portfolio add 100 atm nzx @ 3.20", nil
+	}
+	if isBadSymbol(err) {
+		return err.Error() + ", try something like portfolio add 100 atm nzx @ 3.20", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var h *holding
+	portfolios := make(map[string][]*holding)
+	err = s.store.update(portfoliosKey, &portfolios, func() error {
+		for _, existing := range portfolios[user] {
+			if existing.Symbol == symbol {
+				h = existing
+			}
+		}
+		if h == nil {
+			h = &holding{Symbol: symbol, Currency: q.Currency}
+			portfolios[user] = append(portfolios[user], h)
+		}
+		// keep the average price paid across everything they've bought
+		h.Cost = (h.Cost*h.Shares + cost*shares) / (h.Shares + shares)
+		h.Shares += shares
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("You've got %g %s at an average of $%.2f %s", h.Shares, symbol, h.Cost, h.Currency), nil
+}
+
+func (s *server) removeHolding(user, symbol string) (string, error) {
+	found := false
+	portfolios := make(map[string][]*holding)
+	err := s.store.update(portfoliosKey, &portfolios, func() error {
+		var kept []*holding
+		for _, h := range portfolios[user] {
+			if h.Symbol == symbol {
+				found = true
+				continue
+			}
+			kept = append(kept, h)
+		}
+		portfolios[user] = kept
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "You don't have any " + symbol, nil
+	}
+	return "I've taken " + symbol + " out of your portfolio", nil
+}
+
+// showPortfolio values each holding in its own currency, and the total in currency
+func (s *server) showPortfolio(user, currency string) (string, error) {
+	portfolios := make(map[string][]*holding)
+	err := s.store.load(portfoliosKey, &portfolios)
+	if err != nil {
+		return "", err
+	}
+	holdings := portfolios[user]
+	if len(holdings) == 0 {
+		return "Your portfolio is empty, try portfolio add 100 atm nzx @ 3.20", nil
+	}
+
+	rates := map[string]float64{currency: 1}
+	var value, today, cost float64
+	var r strings.Builder
+	for _, h := range holdings {
+		q, err := s.quotes.Quote(h.Symbol)
+		if err != nil {
+			return "", err
+		}
+		rate, ok := rates[q.Currency]
+		if !ok {
+			rate, err = s.exchangeRate(q.Currency, currency)
+			if err != nil {
+				return "", err
+			}
+			rates[q.Currency] = rate
+		}
+
+		v, c := h.Shares*q.Price, h.Shares*h.Cost
+		r.WriteString(fmt.Sprintf("%s: %g @ $%.2f, now $%.2f = $%.2f %s, today %+.2f, total %+.2f (%+.2f%%)\n",
+			h.Symbol, h.Shares, h.Cost, q.Price, v, q.Currency, h.Shares*q.Change, v-c, (v-c)/c*100))
+
+		value += v * rate
+		today += h.Shares * q.Change * rate
+		cost += c * rate
+	}
+	r.WriteString(fmt.Sprintf("Total: $%.2f %s, today %+.2f, total %+.2f (%+.2f%%)", value, currency, today, value-cost, (value-cost)/cost*100))
+	return r.String(), nil
+}
+
+// exchangeRate is how many of to one from buys, from the quote provider's fx
+// quotes like NZDAUD=X
+func (s *server) exchangeRate(from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	q, err := s.quotes.Quote(strings.ToLower(from + to + "=x"))
+	if err != nil {
+		return 0, err
+	}
+	return q.Price, nil
+}
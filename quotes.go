@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// quote - a share price at a point in time
+type quote struct {
+	Symbol        string    `json:"symbol"`
+	Exchange      string    `json:"exchange"`
+	Currency      string    `json:"currency"`
+	Price         float64   `json:"price"`
+	Change        float64   `json:"change"`
+	PercentChange float64   `json:"percent_change"`
+	Time          time.Time `json:"time"`
+}
+
+// pricePoint - a share price in a price history
+type pricePoint struct {
+	Time  time.Time `json:"time"`
+	Price float64   `json:"price"`
+}
+
+// QuoteProvider - where share prices come from, symbols look like "atm nzx"
+// and periods are one of chartPeriods
+type QuoteProvider interface {
+	Quote(symbol string) (quote, error)
+	History(symbol, period string) ([]pricePoint, error)
+}
+
+// chartPeriods - the periods we chart, and the yahoo range and interval for each
+var chartPeriods = map[string][2]string{
+	"1d": {"1d", "5m"},
+	"1w": {"5d", "30m"},
+	"1m": {"1mo", "1d"},
+	"3m": {"3mo", "1d"},
+	"6m": {"6mo", "1d"},
+	"1y": {"1y", "1d"},
+	"5y": {"5y", "1wk"},
+}
+
+// periodStart is how far back a period goes from end
+func periodStart(period string, end time.Time) time.Time {
+	n, unit := int(period[0]-'0'), period[1:]
+	switch unit {
+	case "d":
+		return end.AddDate(0, 0, -n)
+	case "w":
+		return end.AddDate(0, 0, -7*n)
+	case "m":
+		return end.AddDate(0, -n, 0)
+	}
+	return end.AddDate(-n, 0, 0)
+}
+
+// symbolNotFoundError - the provider doesn't know about the symbol
+type symbolNotFoundError struct {
+	symbol string
+}
+
+func (e symbolNotFoundError) Error() string {
+	return "Could not find symbol: " + e.symbol
+}
+
+func isSymbolNotFound(err error) bool {
+	_, ok := errors.Cause(err).(symbolNotFoundError)
+	return ok
+}
+
+// badSymbolError - the symbol isn't one we can look up, Error says why in
+// a way we can tell the person who asked
+type badSymbolError struct {
+	reason string
+}
+
+func (e badSymbolError) Error() string {
+	return e.reason
+}
+
+func isBadSymbol(err error) bool {
+	_, ok := errors.Cause(err).(badSymbolError)
+	return ok
+}
+
+// the suffix yahoo puts on symbols from each exchange
+var exchangeSuffixes = map[string]string{
+	"nzx":    ".NZ",
+	"asx":    ".AX",
+	"nasdaq": "",
+	"nyse":   "",
+}
+
+// parseSymbol splits eg. "atm nzx" into ATM and NZX, the exchange is optional
+func parseSymbol(symbol string) (string, string, error) {
+	parts := strings.Fields(strings.ToLower(symbol))
+	switch len(parts) {
+	case 1:
+		return strings.ToUpper(parts[0]), "", nil
+	case 2:
+		if _, ok := exchangeSuffixes[parts[1]]; !ok {
+			return "", "", badSymbolError{reason: "I don't know the " + parts[1] + " exchange"}
+		}
+		return strings.ToUpper(parts[0]), strings.ToUpper(parts[1]), nil
+	}
+	return "", "", badSymbolError{reason: "Not a share symbol: " + symbol}
+}
+
+func newQuoteProvider(cfg sharesConfig, client *http.Client) (QuoteProvider, error) {
+	switch cfg.Provider {
+	case "", "yahoo":
+		return newYahooQuotes(client), nil
+	case "fixture":
+		if cfg.Fixtures == "" {
+			return nil, errors.New("The fixture quote provider needs a fixtures file")
+		}
+		return &fixtureQuotes{path: cfg.Fixtures}, nil
+	}
+	return nil, errors.Errorf("Unknown quote provider: %s", cfg.Provider)
+}
+
+// yahooQuotes - quotes from yahoo finance's chart api
+type yahooQuotes struct {
+	client  *http.Client
+	baseURL string
+}
+
+type yahooChart struct {
+	Chart struct {
+		Result []struct {
+			Meta struct {
+				Symbol             string  `json:"symbol"`
+				Currency           string  `json:"currency"`
+				ExchangeName       string  `json:"exchangeName"`
+				RegularMarketPrice float64 `json:"regularMarketPrice"`
+				ChartPreviousClose float64 `json:"chartPreviousClose"`
+				RegularMarketTime  int64   `json:"regularMarketTime"`
+			} `json:"meta"`
+			Timestamp  []int64 `json:"timestamp"`
+			Indicators struct {
+				Quote []struct {
+					Close []*float64 `json:"close"`
+				} `json:"quote"`
+			} `json:"indicators"`
+		} `json:"result"`
+		Error *struct {
+			Code        string `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
+	} `json:"chart"`
+}
+
+func newYahooQuotes(client *http.Client) *yahooQuotes {
+	return &yahooQuotes{client: client, baseURL: "https://query1.finance.yahoo.com"}
+}
+
+func (y *yahooQuotes) Quote(symbol string) (quote, error) {
+	var q quote
+	ticker, exchange, err := parseSymbol(symbol)
+	if err != nil {
+		return q, err
+	}
+
+	c, err := y.chart(symbol, ticker, exchange, "1d", "1d")
+	if err != nil {
+		return q, err
+	}
+
+	m := c.Chart.Result[0].Meta
+	if exchange == "" {
+		exchange = m.ExchangeName
+	}
+	q = quote{
+		Symbol:   ticker,
+		Exchange: exchange,
+		Currency: m.Currency,
+		Price:    m.RegularMarketPrice,
+		Change:   m.RegularMarketPrice - m.ChartPreviousClose,
+		Time:     time.Unix(m.RegularMarketTime, 0),
+	}
+	if m.ChartPreviousClose != 0 {
+		q.PercentChange = q.Change / m.ChartPreviousClose * 100
+	}
+	return q, nil
+}
+
+func (y *yahooQuotes) History(symbol, period string) ([]pricePoint, error) {
+	ticker, exchange, err := parseSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := chartPeriods[period]
+	if !ok {
+		return nil, errors.Errorf("Unknown chart period: %s", period)
+	}
+
+	c, err := y.chart(symbol, ticker, exchange, p[0], p[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// yahoo leaves gaps as nulls when nothing traded
+	var points []pricePoint
+	r := c.Chart.Result[0]
+	for i, ts := range r.Timestamp {
+		if len(r.Indicators.Quote) == 0 || i >= len(r.Indicators.Quote[0].Close) || r.Indicators.Quote[0].Close[i] == nil {
+			continue
+		}
+		points = append(points, pricePoint{Time: time.Unix(ts, 0), Price: *r.Indicators.Quote[0].Close[i]})
+	}
+	return points, nil
+}
+
+func (y *yahooQuotes) chart(symbol, ticker, exchange, rng, interval string) (yahooChart, error) {
+	var c yahooChart
+	u := fmt.Sprintf("%s/v8/finance/chart/%s?range=%s&interval=%s", y.baseURL, url.PathEscape(ticker+exchangeSuffixes[strings.ToLower(exchange)]), rng, interval)
+	resp, err := y.client.Get(u)
+	if err != nil {
+		return c, errors.Wrapf(err, "Could not make request to %s", u)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return c, errors.Wrapf(err, "Could not read request for %s", u)
+	}
+
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return c, errors.Wrapf(err, "Could not deserialise quote from %s", u)
+	}
+	if resp.StatusCode == http.StatusNotFound || (c.Chart.Error != nil && c.Chart.Error.Code == "Not Found") {
+		return c, symbolNotFoundError{symbol: symbol}
+	}
+	if c.Chart.Error != nil {
+		return c, errors.Errorf("Yahoo returned %s for %s: %s", c.Chart.Error.Code, u, c.Chart.Error.Description)
+	}
+	if resp.StatusCode != http.StatusOK || len(c.Chart.Result) == 0 {
+		return c, errors.Errorf("Yahoo returned %d for %s", resp.StatusCode, u)
+	}
+	return c, nil
+}
+
+// fixtureQuotes - quotes from a json file of symbol to quote, eg.
+// {"ATM NZX": {"price": 11.99, "currency": "NZD", "history": [{"time": "2018-09-14T04:00:00Z", "price": 11.8}]}},
+// for running offline
+type fixtureQuotes struct {
+	path string
+}
+
+type fixtureQuote struct {
+	quote
+	History []pricePoint `json:"history"`
+}
+
+func (f *fixtureQuotes) Quote(symbol string) (quote, error) {
+	fq, err := f.fixture(symbol)
+	return fq.quote, err
+}
+
+// History is the fixture's history for the period before its last point
+func (f *fixtureQuotes) History(symbol, period string) ([]pricePoint, error) {
+	fq, err := f.fixture(symbol)
+	if err != nil || len(fq.History) == 0 {
+		return nil, err
+	}
+	if _, ok := chartPeriods[period]; !ok {
+		return nil, errors.Errorf("Unknown chart period: %s", period)
+	}
+
+	start := periodStart(period, fq.History[len(fq.History)-1].Time)
+	var points []pricePoint
+	for _, p := range fq.History {
+		if !p.Time.Before(start) {
+			points = append(points, p)
+		}
+	}
+	return points, nil
+}
+
+func (f *fixtureQuotes) fixture(symbol string) (fixtureQuote, error) {
+	var fq fixtureQuote
+	ticker, exchange, err := parseSymbol(symbol)
+	if err != nil {
+		return fq, err
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return fq, errors.Wrapf(err, "Could not read quote fixtures: %s", f.path)
+	}
+	fixtures := make(map[string]fixtureQuote)
+	err = json.Unmarshal(data, &fixtures)
+	if err != nil {
+		return fq, errors.Wrapf(err, "Could not deserialise quote fixtures: %s", f.path)
+	}
+
+	fq, ok := fixtures[strings.TrimSpace(ticker+" "+exchange)]
+	if !ok {
+		return fq, symbolNotFoundError{symbol: symbol}
+	}
+	fq.Symbol, fq.Exchange = ticker, exchange
+	return fq, nil
+}
+
+// String is eg. ATM (NZX): $11.99 NZD +0.19 (+1.61%)
+func (q quote) String() string {
+	name := q.Symbol
+	if q.Exchange != "" {
+		name += " (" + q.Exchange + ")"
+	}
+	return fmt.Sprintf("%s: $%.2f %s %+.2f (%+.2f%%)", name, q.Price, q.Currency, q.Change, q.PercentChange)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+const digestsKey = "meetup_digests"
+
+// the reactions people click to add an event from a digest, in order
+var numberReactions = []string{"one", "two", "three", "four", "five", "six", "seven", "eight", "nine"}
+
+// recommendation - an upcoming event from a group or feed we follow
+type recommendation struct {
+	Name        string    `json:"name"`
+	Link        string    `json:"link"`
+	Description string    `json:"description"`
+	Start       time.Time `json:"start"`
+	Added       bool      `json:"added"`
+}
+
+// digest - the recommendations we posted, keyed by the message they are on
+type digest struct {
+	Channel string           `json:"channel"`
+	Posted  time.Time        `json:"posted"`
+	Events  []recommendation `json:"events"`
+}
+
+// upcomingRecommendations polls the groups and feeds we follow for events
+// between now and until, a group or feed that fails doesn't stop the rest
+func upcomingRecommendations(client *http.Client, cfg meetupsConfig, now, until time.Time) []recommendation {
+	var recs []recommendation
+
+	meetups := newMeetupClient(client)
+	for _, g := range cfg.Groups {
+		events, err := meetups.upcomingEvents(g)
+		if err != nil {
+			fmt.Printf("Error: Could not get events for %s: %s\n", g, err)
+			continue
+		}
+		for _, e := range events {
+			start, _ := e.start()
+			recs = append(recs, recommendation{Name: e.Name, Link: e.Link, Description: e.description(), Start: start})
+		}
+	}
+
+	for _, f := range cfg.Feeds {
+		req, err := http.NewRequest("GET", f, nil)
+		if err != nil {
+			fmt.Printf("Error: Bad feed %s: %s\n", f, err)
+			continue
+		}
+		events, skipped, err := fetchICS(client, req)
+		if err != nil {
+			fmt.Printf("Error: Could not get events for %s: %s\n", f, err)
+			continue
+		}
+		for _, sk := range skipped {
+			fmt.Printf("Error: Skipped %s in %s\n", sk, f)
+		}
+		for _, e := range events {
+			recs = append(recs, recommendation{Name: e.Summary, Link: e.URL, Description: e.description(), Start: e.Start})
+		}
+	}
+
+	var res []recommendation
+	for _, r := range recs {
+		if !r.Start.Before(now) && r.Start.Before(until) {
+			res = append(res, r)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Start.Before(res[j].Start) })
+	return res
+}
+
+// postMeetupDigest posts next fortnight's events from the groups we follow
+// that aren't on the board and haven't been in a digest already
+func (s *server) postMeetupDigest(client *http.Client, now time.Time) error {
+	cfg := s.config.Meetups
+	if len(cfg.Groups) == 0 && len(cfg.Feeds) == 0 {
+		return nil
+	}
+
+	board, err := s.backlog.Items(meetupsList)
+	if err != nil {
+		return errors.Wrap(err, "Could not get meetups for digest")
+	}
+	digests := make(map[string]*digest)
+	err = s.store.load(digestsKey, &digests)
+	if err != nil {
+		return err
+	}
+
+	var recs []recommendation
+	for _, r := range upcomingRecommendations(client, cfg, now, now.Add(14*24*time.Hour)) {
+		if !alreadyKnown(r, board, digests) && len(recs) < len(numberReactions) {
+			recs = append(recs, r)
+		}
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+
+	var text strings.Builder
+	text.WriteString("Here's what's coming up at the meetups we follow:\n")
+	for i, r := range recs {
+		text.WriteString(":" + numberReactions[i] + ": " + r.Name + " - " + formatDue(r.Start))
+		if r.Link != "" {
+			text.WriteString(" " + r.Link)
+		}
+		text.WriteString("\n")
+	}
+	text.WriteString("React with the number and I'll add it to the trello board")
+
+	channel := cfg.channel()
+	_, ts, err := s.slack.PostMessage(channel, text.String(), slack.PostMessageParameters{AsUser: true})
+	if err != nil {
+		return errors.Wrap(err, "Could not post meetup digest")
+	}
+	for i := range recs {
+		err = s.slack.AddReaction(numberReactions[i], slack.NewRefToMessage(channel, ts))
+		if err != nil {
+			fmt.Printf("Error: Could not add %s to meetup digest: %s\n", numberReactions[i], err)
+		}
+	}
+
+	return s.store.update(digestsKey, &digests, func() error {
+		for ts, d := range digests {
+			if d.Posted.Before(now.Add(-30 * 24 * time.Hour)) {
+				delete(digests, ts)
+			}
+		}
+		digests[ts] = &digest{Channel: channel, Posted: now, Events: recs}
+		return nil
+	})
+}
+
+// addRecommendation adds the event someone picked from a digest to the board
+func (s *server) addRecommendation(reaction, ts string) error {
+	n := -1
+	for i, r := range numberReactions {
+		if r == reaction {
+			n = i
+		}
+	}
+	if n == -1 {
+		return nil
+	}
+
+	var rec recommendation
+	var channel string
+	digests := make(map[string]*digest)
+	err := s.store.update(digestsKey, &digests, func() error {
+		d, ok := digests[ts]
+		if !ok || n >= len(d.Events) || d.Events[n].Added {
+			return nil
+		}
+		d.Events[n].Added = true
+		rec = d.Events[n]
+		channel = d.Channel
+		return nil
+	})
+	if err != nil || rec.Name == "" {
+		return err
+	}
+
+	title := rec.Name
+	if rec.Link != "" {
+		title += " - " + rec.Link
+	}
+	start := rec.Start
+	item := &backlogItem{Title: title, Description: rec.Description, URL: rec.Link, Due: &start}
+	resp, err := s.recordMeetup(item, rec.Name, channel, "I've added "+rec.Name+" to the trello board for you :)")
+	if err != nil {
+		return err
+	}
+	if resp != "" {
+		s.slack.SendMessage(s.slack.NewOutgoingMessage(resp, channel))
+	}
+	return nil
+}
+
+func alreadyKnown(r recommendation, board []backlogItem, digests map[string]*digest) bool {
+	same := func(name, link string) bool {
+		if r.Link != "" && link != "" {
+			return r.Link == link
+		}
+		return strings.EqualFold(r.Name, name)
+	}
+
+	for _, i := range board {
+		if (r.Link != "" && strings.Contains(i.Title+i.Description, r.Link)) || strings.EqualFold(i.Title, r.Name) {
+			return true
+		}
+	}
+	for _, d := range digests {
+		for _, e := range d.Events {
+			if same(e.Name, e.Link) && e.Start.Equal(r.Start) {
+				return true
+			}
+		}
+	}
+	return false
+}
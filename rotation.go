@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	rotationsKey = "rotations"
+
+	// how many turns we remember for each rotation
+	rotationHistory = 50
+)
+
+// rotation - people taking turns at something, Current is the index in
+// Members of who's up, or -1 before anyone has had a go. Weekly rotations
+// move on and are announced in Channel every Monday morning
+type rotation struct {
+	Name    string         `json:"name"`
+	Channel string         `json:"channel"`
+	Members []string       `json:"members"`
+	Current int            `json:"current"`
+	Weekly  bool           `json:"weekly"`
+	History []rotationTurn `json:"history"`
+}
+
+// rotationTurn - someone being up, Note says if it was a skip or swap
+type rotationTurn struct {
+	User string    `json:"user"`
+	Time time.Time `json:"time"`
+	Note string    `json:"note,omitempty"`
+}
+
+// rotationCommand handles eg.
+//
+//	rotation create standup-host <@U1> <@U2> <@U3> weekly
+//	rotation next standup-host
+//	rotation skip standup-host
+//	rotation swap standup-host <@U1> <@U3>
+//	rotation history standup-host
+//	rotation standup-host
+//	rotations
+func (s *server) rotationCommand(channel, text string, now time.Time) (string, error) {
+	usage := "Try rotation create standup-host @ruskin.dantra @dhruv, then rotation next standup-host"
+	words := strings.Fields(text)[1:]
+	if len(words) == 0 || strings.HasPrefix(text, "rotations") {
+		return s.listRotations()
+	}
+	if len(words) == 1 {
+		return s.showRotation(words[0])
+	}
+
+	name := words[1]
+	switch words[0] {
+	case "create":
+		members, rest := parseMentions(words[2:])
+		weekly := len(rest) == 1 && rest[0] == "weekly"
+		if len(members) == 0 || (len(rest) > 0 && !weekly) {
+			return usage, nil
+		}
+		return s.createRotation(rotation{Name: name, Channel: channel, Members: members, Current: -1, Weekly: weekly})
+	case "next":
+		return s.changeRotation(name, func(r *rotation) (string, error) {
+			r.advance(now, "")
+			return "<@" + r.Members[r.Current] + "> is up for " + r.Name, nil
+		})
+	case "skip":
+		return s.changeRotation(name, func(r *rotation) (string, error) {
+			if r.Current < 0 {
+				return "Nobody is up for " + r.Name + " yet, try rotation next " + r.Name, nil
+			}
+			if len(r.Members) == 1 {
+				return "There's nobody else in " + r.Name + " to take over", nil
+			}
+			// whoever is skipped goes straight after, so they don't miss their turn
+			skipped := r.Members[r.Current]
+			next := (r.Current + 1) % len(r.Members)
+			r.Members[r.Current], r.Members[next] = r.Members[next], r.Members[r.Current]
+			r.Current--
+			r.advance(now, "skipped <@"+skipped+">")
+			return "<@" + r.Members[r.Current] + "> is up for " + r.Name + " instead, <@" + skipped + "> is next", nil
+		})
+	case "swap":
+		users, rest := parseMentions(words[2:])
+		if len(users) != 2 || len(rest) > 0 {
+			return "Tell me who to swap, eg. rotation swap " + name + " @ruskin.dantra @dhruv", nil
+		}
+		return s.changeRotation(name, func(r *rotation) (string, error) {
+			a, b := indexOf(r.Members, users[0]), indexOf(r.Members, users[1])
+			if a == -1 || b == -1 {
+				return "They both need to be in " + r.Name + " to swap", nil
+			}
+			r.Members[a], r.Members[b] = r.Members[b], r.Members[a]
+			if r.Current == a || r.Current == b {
+				r.record(now, "swapped <@"+r.Members[b]+"> and <@"+r.Members[a]+">")
+			}
+			return "Done, <@" + users[0] + "> and <@" + users[1] + "> have swapped\n" + r.String(), nil
+		})
+	case "history":
+		return s.rotationHistory(name)
+	case "delete":
+		return s.deleteRotation(name)
+	}
+	return usage, nil
+}
+
+// advance moves the rotation on to the next person
+func (r *rotation) advance(now time.Time, note string) {
+	r.Current = (r.Current + 1) % len(r.Members)
+	r.record(now, note)
+}
+
+func (r *rotation) record(now time.Time, note string) {
+	r.History = append(r.History, rotationTurn{User: r.Members[r.Current], Time: now, Note: note})
+	if len(r.History) > rotationHistory {
+		r.History = r.History[len(r.History)-rotationHistory:]
+	}
+}
+
+// String is eg. standup-host: <@U1>, *<@U2>*, <@U3> with who's up in bold
+func (r *rotation) String() string {
+	var members []string
+	for i, m := range r.Members {
+		if i == r.Current {
+			members = append(members, "*<@"+m+">*")
+		} else {
+			members = append(members, "<@"+m+">")
+		}
+	}
+	text := r.Name + ": " + strings.Join(members, ", ")
+	if r.Weekly {
+		text += " (weekly)"
+	}
+	return text
+}
+
+func (s *server) createRotation(r rotation) (string, error) {
+	exists := false
+	rotations := make(map[string]*rotation)
+	err := s.store.update(rotationsKey, &rotations, func() error {
+		if rotations[r.Name] != nil {
+			exists = true
+			return nil
+		}
+		rotations[r.Name] = &r
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "There's already a rotation called " + r.Name, nil
+	}
+	text := "Created " + r.String() + ", rotation next " + r.Name + " to get started"
+	if r.Weekly {
+		text = "Created " + r.String() + ", I'll announce who's up every Monday morning"
+	}
+	return text, nil
+}
+
+func (s *server) deleteRotation(name string) (string, error) {
+	found := false
+	rotations := make(map[string]*rotation)
+	err := s.store.update(rotationsKey, &rotations, func() error {
+		found = rotations[name] != nil
+		delete(rotations, name)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "There isn't a rotation called " + name, nil
+	}
+	return "Deleted " + name, nil
+}
+
+// changeRotation lets change update the rotation called name and returns its reply
+func (s *server) changeRotation(name string, change func(r *rotation) (string, error)) (string, error) {
+	var resp string
+	rotations := make(map[string]*rotation)
+	err := s.store.update(rotationsKey, &rotations, func() error {
+		r := rotations[name]
+		if r == nil {
+			resp = "There isn't a rotation called " + name + ", try rotation create " + name + " @ruskin.dantra @dhruv"
+			return nil
+		}
+		var err error
+		resp, err = change(r)
+		return err
+	})
+	return resp, err
+}
+
+func (s *server) showRotation(name string) (string, error) {
+	rotations := make(map[string]*rotation)
+	err := s.store.load(rotationsKey, &rotations)
+	if err != nil {
+		return "", err
+	}
+	r := rotations[name]
+	if r == nil {
+		return "There isn't a rotation called " + name, nil
+	}
+	return r.String(), nil
+}
+
+func (s *server) listRotations() (string, error) {
+	rotations := make(map[string]*rotation)
+	err := s.store.load(rotationsKey, &rotations)
+	if err != nil {
+		return "", err
+	}
+	if len(rotations) == 0 {
+		return "There aren't any rotations yet, try rotation create standup-host @ruskin.dantra @dhruv", nil
+	}
+	var names []string
+	for name := range rotations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, rotations[name].String())
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *server) rotationHistory(name string) (string, error) {
+	rotations := make(map[string]*rotation)
+	err := s.store.load(rotationsKey, &rotations)
+	if err != nil {
+		return "", err
+	}
+	r := rotations[name]
+	if r == nil {
+		return "There isn't a rotation called " + name, nil
+	}
+	if len(r.History) == 0 {
+		return "Nobody has been up for " + name + " yet", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("Who's been up for " + name + ":\n")
+	start := len(r.History) - 10
+	if start < 0 {
+		start = 0
+	}
+	for i := len(r.History) - 1; i >= start; i-- {
+		t := r.History[i]
+		b.WriteString(t.Time.In(loadLocation("Pacific/Auckland")).Format("Mon 2 Jan") + " <@" + t.User + ">")
+		if t.Note != "" {
+			b.WriteString(" (" + t.Note + ")")
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// announceRotations moves the weekly rotations on, and lets their channels
+// know who's up this week
+func (s *server) announceRotations(now time.Time) error {
+	var announcements []*rotation
+	rotations := make(map[string]*rotation)
+	err := s.store.update(rotationsKey, &rotations, func() error {
+		for _, r := range rotations {
+			if r.Weekly && len(r.Members) > 0 {
+				r.advance(now, "")
+				announcements = append(announcements, r)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "Could not move rotations on")
+	}
+
+	sort.Slice(announcements, func(i, j int) bool { return announcements[i].Name < announcements[j].Name })
+	for _, r := range announcements {
+		s.slack.SendMessage(s.slack.NewOutgoingMessage(fmt.Sprintf(":calendar: <@%s> is up for %s this week", r.Members[r.Current], r.Name), r.Channel))
+	}
+	return nil
+}
+
+func indexOf(list []string, s string) int {
+	for i, l := range list {
+		if l == s {
+			return i
+		}
+	}
+	return -1
+}
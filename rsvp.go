@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+const (
+	rsvpKey       = "rsvps"
+	goingReaction = "white_check_mark"
+	maybeReaction = "thinking_face"
+)
+
+// rsvp - who from the team is going to a meetup, collected from reactions on its announcement
+type rsvp struct {
+	ItemID string   `json:"item_id"`
+	Title  string   `json:"title"`
+	Going  []string `json:"going"`
+	Maybe  []string `json:"maybe"`
+}
+
+// announceMeetup posts text with going / maybe reactions for people to click
+func (s *server) announceMeetup(channel, text string, item backlogItem, title string) error {
+	_, ts, err := s.slack.PostMessage(channel, text, slack.PostMessageParameters{AsUser: true})
+	if err != nil {
+		return errors.Wrapf(err, "Could not announce meetup: %s", title)
+	}
+
+	for _, r := range []string{goingReaction, maybeReaction} {
+		err = s.slack.AddReaction(r, slack.NewRefToMessage(channel, ts))
+		if err != nil {
+			return errors.Wrapf(err, "Could not add %s to meetup announcement", r)
+		}
+	}
+
+	rsvps := make(map[string]*rsvp)
+	return s.store.update(rsvpKey, &rsvps, func() error {
+		rsvps[ts] = &rsvp{ItemID: item.ID, Title: title}
+		return nil
+	})
+}
+
+// recordRSVP keeps track of going / maybe reactions on meetup announcements
+func (s *server) recordRSVP(user, reaction, ts string, added bool) error {
+	if reaction != goingReaction && reaction != maybeReaction {
+		return nil
+	}
+
+	rsvps := make(map[string]*rsvp)
+	return s.store.update(rsvpKey, &rsvps, func() error {
+		r, ok := rsvps[ts]
+		if !ok {
+			return nil
+		}
+
+		list := &r.Going
+		if reaction == maybeReaction {
+			list = &r.Maybe
+		}
+		*list = removeString(*list, user)
+		if added {
+			*list = append(*list, user)
+		}
+		return nil
+	})
+}
+
+// rsvpsByItem - the rsvps for each backlog item
+func (s *server) rsvpsByItem() (map[string]*rsvp, error) {
+	rsvps := make(map[string]*rsvp)
+	err := s.store.load(rsvpKey, &rsvps)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*rsvp)
+	for _, r := range rsvps {
+		res[r.ItemID] = r
+	}
+	return res, nil
+}
+
+// whosGoing answers who's going to <meetup>
+func (s *server) whosGoing(text string) (string, error) {
+	i := strings.Index(text, "going to")
+	name := strings.TrimSpace(strings.TrimSuffix(text[i+len("going to"):], "?"))
+	if name == "" {
+		return "which meetup? eg. who's going to golang night", nil
+	}
+
+	rsvps := make(map[string]*rsvp)
+	err := s.store.load(rsvpKey, &rsvps)
+	if err != nil {
+		return "", errors.Wrap(err, "Could not load rsvps")
+	}
+
+	var matches []*rsvp
+	for _, r := range rsvps {
+		if strings.Contains(strings.ToLower(r.Title), name) {
+			matches = append(matches, r)
+		}
+	}
+	if len(matches) == 0 {
+		return "I don't know of a meetup called " + name, nil
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Title < matches[j].Title })
+
+	var res strings.Builder
+	for _, r := range matches {
+		if len(r.Going) == 0 && len(r.Maybe) == 0 {
+			res.WriteString("Nobody has said they're going to " + r.Title + " yet\n")
+			continue
+		}
+		res.WriteString(r.Title + " - " + r.attendees() + "\n")
+	}
+	return res.String(), nil
+}
+
+func (r *rsvp) attendees() string {
+	var parts []string
+	if len(r.Going) > 0 {
+		parts = append(parts, "going: "+mentions(r.Going))
+	}
+	if len(r.Maybe) > 0 {
+		parts = append(parts, "maybe: "+mentions(r.Maybe))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func mentions(users []string) string {
+	m := make([]string, len(users))
+	for i, u := range users {
+		m[i] = "<@" + u + ">"
+	}
+	return strings.Join(m, " ")
+}
+
+func removeString(arr []string, s string) []string {
+	res := arr[:0]
+	for _, a := range arr {
+		if a != s {
+			res = append(res, a)
+		}
+	}
+	return res
+}
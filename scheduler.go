@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// scheduler runs jobs at set times. It is ticked by slack's latency reports,
+// which come every 30 seconds or so, and runs each job at most once a minute.
+type scheduler struct {
+	clock clock
+	jobs  []job
+	last  map[string]time.Time
+}
+
+type job struct {
+	name string
+	due  func(now time.Time) bool
+	run  func() error
+}
+
+func newScheduler(clock clock) *scheduler {
+	return &scheduler{clock: clock, last: make(map[string]time.Time)}
+}
+
+func (s *scheduler) add(name string, due func(now time.Time) bool, run func() error) {
+	s.jobs = append(s.jobs, job{name: name, due: due, run: run})
+}
+
+func (s *scheduler) tick() {
+	now := s.clock.Now()
+	minute := now.Truncate(time.Minute)
+
+	for _, j := range s.jobs {
+		if !j.due(now) || s.last[j.name].Equal(minute) {
+			continue
+		}
+		s.last[j.name] = minute
+
+		if err := j.run(); err != nil {
+			fmt.Printf("Error: %s failed: %s\n", j.name, err)
+		}
+	}
+}
+
+// weekly is due at hour:minute on day in loc
+func weekly(loc *time.Location, day time.Weekday, hour, minute int) func(time.Time) bool {
+	return func(now time.Time) bool {
+		now = now.In(loc)
+		return now.Weekday() == day && now.Hour() == hour && now.Minute() == minute
+	}
+}
+
+// daily is due at hour:minute in loc
+func daily(loc *time.Location, hour, minute int) func(time.Time) bool {
+	return func(now time.Time) bool {
+		now = now.In(loc)
+		return now.Hour() == hour && now.Minute() == minute
+	}
+}
+
+// every is due every d, which should be a whole number of minutes
+func every(d time.Duration) func(time.Time) bool {
+	return func(now time.Time) bool {
+		return now.Truncate(d).Equal(now.Truncate(time.Minute))
+	}
+}
+
+// loadLocation falls back to UTC so a missing timezone doesn't stop the bot
+func loadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		fmt.Printf("Could not find timezone %s: %s\n", name, err)
+		return time.UTC
+	}
+	return loc
+}
@@ -2,22 +2,16 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
 	"strings"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
-func getScheduledUpdate(client *http.Client) (string, error) {
-	shares := []string{"atm nzx", "xro asx"}
-
+func getScheduledUpdate(quotes QuoteProvider, shares []string) (string, error) {
 	var res strings.Builder
 	for _, share := range shares {
-		r, err := getSharePrice(client, share)
+		r, err := getSharePrice(quotes, share)
 		if err != nil {
+			fmt.Printf("Error: %s\n", err)
 			continue
 		}
 		res.WriteString(r)
@@ -27,27 +21,21 @@ func getScheduledUpdate(client *http.Client) (string, error) {
 	return res.String(), nil
 }
 
-func getSharePrice(client *http.Client, symbol string) (string, error) {
+func getSharePrice(quotes QuoteProvider, symbol string) (string, error) {
 	symbol = strings.TrimPrefix(symbol, "price")
 	symbol = strings.TrimSpace(symbol)
 
-	u := fmt.Sprintf("https://www.google.co.nz/search?q=%s", url.QueryEscape(symbol))
-	resp, err := client.Get(u)
-	if err != nil {
-		return "", errors.Wrapf(err, "Could not make request to %s", u)
+	q, err := quotes.Quote(symbol)
+	if isSymbolNotFound(err) {
+		return "I couldn't find a share called " + symbol + ", try something like price atm nzx", nil
+	}
+	if isBadSymbol(err) {
+		return err.Error() + ", try something like price atm nzx", nil
 	}
-
-	data, err := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
 	if err != nil {
-		return "", errors.Wrapf(err, "Could not read request for %s", u)
+		return "", err
 	}
-
-	d := string(data)
-	span := strings.Index(d, "<span style=\"font-size:157%\"><b>")
-	f := strings.Index(d[span+32:], "</b>")
-
-	return symbol + ": $" + d[span+32:span+32+f], nil
+	return q.String(), nil
 }
 
 type clock interface {
@@ -60,25 +48,45 @@ type realClock struct{}
 func (realClock) Now() time.Time                                { return time.Now() }
 func (realClock) LoadLocation(l string) (*time.Location, error) { return time.LoadLocation(l) }
 
-func shouldSendUpdate(clock clock) bool {
-	loc, err := clock.LoadLocation("UTC")
+// sharesDue is which of the watchlist's shares are due an update. At open
+// and close it is the shares on the exchange that just opened or closed,
+// at a set time it is the shares on exchanges that are trading that day
+func sharesDue(clock clock, w *watchlist) []string {
+	loc, err := clock.LoadLocation(w.timezone())
 	if err != nil {
 		fmt.Println("Could not find timezone")
-		return false
+		return nil
 	}
 	now := clock.Now().In(loc)
 
-	h := []int{22, 0, 2, 4}
-	if now.Weekday() < 5 && contains(h, now.Hour()) &&
-		now.Minute() == 30 && now.Second() < 30 {
-		return true
+	var due []string
+	for _, symbol := range w.Symbols {
+		e := exchangeFor(symbol)
+		for _, t := range w.times() {
+			if updateDue(e, now, t) {
+				due = append(due, symbol)
+				break
+			}
+		}
 	}
-	return false
+	return due
+}
+
+func updateDue(e *exchange, now time.Time, t string) bool {
+	switch {
+	case t == "open" || t == "close":
+		return e != nil && e.at(now, t)
+	case t != now.Format("15:04"):
+		return false
+	case e != nil:
+		return e.tradingDay(now)
+	}
+	return now.Weekday() != time.Saturday && now.Weekday() != time.Sunday
 }
 
-func contains(arr []int, h int) bool {
+func contains(arr []string, s string) bool {
 	for _, a := range arr {
-		if a == h {
+		if a == s {
 			return true
 		}
 	}
@@ -9,8 +9,14 @@ type SlackRTMInterface interface {
 	SendMessage(msg *slack.OutgoingMessage)
 	GetIncomingEvents() chan slack.RTMEvent
 	GetUserInfo(user string) (*slack.User, error)
+	GetUsers() ([]slack.User, error)
 	OpenIMChannel(user string) (bool, bool, string, error)
-	GetChannelInfo(channelID string) (*slack.Channel, error)
+	GetUsersInConversation(params *slack.GetUsersInConversationParameters) ([]string, string, error)
+	PostMessage(channel, text string, params slack.PostMessageParameters) (string, string, error)
+	AddReaction(name string, item slack.ItemRef) error
+	UploadFile(params slack.FileUploadParameters) (*slack.File, error)
+	GetUserPresence(user string) (*slack.UserPresence, error)
+	GetDNDInfo(user *string) (*slack.DNDStatus, error)
 }
 
 type slackRTM struct {
@@ -34,14 +40,18 @@ func (s *slackRTM) OpenIMChannel(user string) (bool, bool, string, error) {
 	return s.rtm.OpenIMChannel(user)
 }
 
-func (s *slackRTM) GetChannelInfo(channelID string) (*slack.Channel, error) {
-	return s.rtm.GetChannelInfo(channelID)
+func (s *slackRTM) GetUsersInConversation(params *slack.GetUsersInConversationParameters) ([]string, string, error) {
+	return s.rtm.GetUsersInConversation(params)
 }
 
 func (s *slackRTM) GetUserInfo(user string) (*slack.User, error) {
 	return s.rtm.GetUserInfo(user)
 }
 
+func (s *slackRTM) GetUsers() ([]slack.User, error) {
+	return s.rtm.GetUsers()
+}
+
 func (s *slackRTM) GetInfo() *slack.Info {
 	return s.rtm.GetInfo()
 }
@@ -57,3 +67,23 @@ func (s *slackRTM) SendMessage(msg *slack.OutgoingMessage) {
 func (s *slackRTM) NewOutgoingMessage(text string, channelID string, options ...slack.RTMsgOption) *slack.OutgoingMessage {
 	return s.rtm.NewOutgoingMessage(text, channelID, options...)
 }
+
+func (s *slackRTM) PostMessage(channel, text string, params slack.PostMessageParameters) (string, string, error) {
+	return s.rtm.PostMessage(channel, text, params)
+}
+
+func (s *slackRTM) AddReaction(name string, item slack.ItemRef) error {
+	return s.rtm.AddReaction(name, item)
+}
+
+func (s *slackRTM) UploadFile(params slack.FileUploadParameters) (*slack.File, error) {
+	return s.rtm.UploadFile(params)
+}
+
+func (s *slackRTM) GetUserPresence(user string) (*slack.UserPresence, error) {
+	return s.rtm.GetUserPresence(user)
+}
+
+func (s *slackRTM) GetDNDInfo(user *string) (*slack.DNDStatus, error) {
+	return s.rtm.GetDNDInfo(user)
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	standupsKey    = "standups"
+	standupRunsKey = "standup_runs"
+
+	defaultStandupTimezone = "Pacific/Auckland"
+	defaultStandupWindow   = time.Hour
+)
+
+var defaultStandupQuestions = []string{
+	"What did you get done yesterday?",
+	"What are you working on today?",
+	"Is anything blocking you?",
+}
+
+// standup - a channel's async standup. At Time on weekdays everyone in
+// Members, or everyone in the channel when there aren't any, is DMed the
+// questions, and the answers are posted in the channel at Summary
+type standup struct {
+	Channel   string   `json:"channel"`
+	Time      string   `json:"time"`
+	Summary   string   `json:"summary,omitempty"`
+	Timezone  string   `json:"timezone,omitempty"`
+	Questions []string `json:"questions,omitempty"`
+	Members   []string `json:"members,omitempty"`
+}
+
+func (s *standup) location() *time.Location {
+	if s.Timezone == "" {
+		return loadLocation(defaultStandupTimezone)
+	}
+	return loadLocation(s.Timezone)
+}
+
+func (s *standup) questions() []string {
+	if len(s.Questions) == 0 {
+		return defaultStandupQuestions
+	}
+	return s.Questions
+}
+
+// summaryTime is when the answers are posted for a standup started at start
+func (s *standup) summaryTime(start time.Time) time.Time {
+	if s.Summary == "" {
+		return start.Add(defaultStandupWindow)
+	}
+	start = start.In(s.location())
+	t, _ := time.ParseInLocation("15:04", s.Summary, s.location())
+	end := time.Date(start.Year(), start.Month(), start.Day(), t.Hour(), t.Minute(), 0, 0, s.location())
+	if !end.After(start) {
+		return start.Add(defaultStandupWindow)
+	}
+	return end
+}
+
+// standupRun - a standup that's collecting answers. IMs is each member's DM
+// channel with rudolph, and Answers are their answers so far
+type standupRun struct {
+	Channel   string              `json:"channel"`
+	Timezone  string              `json:"timezone"`
+	Questions []string            `json:"questions"`
+	Started   time.Time           `json:"started"`
+	Due       time.Time           `json:"due"`
+	Nudged    bool                `json:"nudged"`
+	Members   []string            `json:"members"`
+	IMs       map[string]string   `json:"ims"`
+	Answers   map[string][]string `json:"answers"`
+}
+
+// clock is eg. 3:04pm in the standup's timezone
+func (r *standupRun) clock(t time.Time) string {
+	return t.In(loadLocation(r.Timezone)).Format("3:04pm")
+}
+
+func (r *standupRun) waitingOn(user string) bool {
+	return contains(r.Members, user) && len(r.Answers[user]) < len(r.Questions)
+}
+
+// standupCommand handles eg.
+//
+//	standup at 9:30am
+//	standup at 9:30am until 10:30am Australia/Sydney
+//	standup questions What did you do? | What's next? | Any blockers?
+//	standup members <@U1> <@U2>
+//	standup now
+//	standup off
+//	standup
+func (s *server) standupCommand(user, channel, text string, now time.Time) (string, error) {
+	original := strings.Fields(text)[1:]
+	words := strings.Fields(strings.ToLower(text))[1:]
+	usage := "Try standup at 9:30am, standup questions What did you do? | What's next?, standup members @ruskin.dantra @dhruv, standup now or standup off"
+	if len(words) == 0 {
+		return s.showStandup(channel)
+	}
+
+	var reply string
+	var change func(su *standup)
+	switch words[0] {
+	case "at":
+		if len(words) < 2 {
+			return "Tell me when, eg. standup at 9:30am", nil
+		}
+		at, ok := parseClockTime(words[1])
+		if !ok {
+			return "I don't know what time " + words[1] + " is, try something like 9:30am", nil
+		}
+		summary := ""
+		rest := original[2:]
+		if len(rest) >= 2 && strings.ToLower(rest[0]) == "until" {
+			summary, ok = parseClockTime(rest[1])
+			if !ok || summary <= at {
+				return "The summary has to be after the standup, eg. standup at 9:30am until 10:30am", nil
+			}
+			rest = rest[2:]
+		}
+		tz := ""
+		if len(rest) == 1 {
+			// timezones are case sensitive
+			if _, err := time.LoadLocation(rest[0]); err != nil {
+				return "I don't know the timezone " + rest[0] + ", try something like Australia/Sydney", nil
+			}
+			tz = rest[0]
+		} else if len(rest) > 1 {
+			return usage, nil
+		}
+		change = func(su *standup) { su.Time, su.Summary, su.Timezone = at, summary, tz }
+		reply = "Standup is at " + at + " on weekdays, I'll DM everyone the questions and post the answers here"
+
+	case "questions":
+		var questions []string
+		for _, q := range strings.Split(strings.Join(original[1:], " "), "|") {
+			if q = strings.TrimSpace(q); q != "" {
+				questions = append(questions, q)
+			}
+		}
+		if len(questions) == 0 {
+			return "Tell me the questions, split up with |, eg. standup questions What did you do? | What's next?", nil
+		}
+		change = func(su *standup) { su.Questions = questions }
+		reply = fmt.Sprintf("Got it, %d %s", len(questions), plural(len(questions), "question"))
+
+	case "members":
+		members, rest := parseMentions(original[1:])
+		if len(rest) > 0 {
+			return usage, nil
+		}
+		change = func(su *standup) { su.Members = members }
+		reply = "Everyone in the channel will get asked"
+		if len(members) > 0 {
+			reply = "Got it, " + personCount(len(members)) + " will get asked"
+		}
+
+	case "now":
+		standups := make(map[string]*standup)
+		err := s.store.load(standupsKey, &standups)
+		if err != nil {
+			return "", err
+		}
+		su := standups[channel]
+		if su == nil {
+			su = &standup{Channel: channel}
+		}
+		asking, err := s.standupMembers(su)
+		if err != nil {
+			return "", err
+		}
+		return s.guardDMs(user, "standup", asking, now, func() (string, []string, error) {
+			return s.startStandup(su, asking, now)
+		})
+
+	case "off":
+		standups := make(map[string]*standup)
+		err := s.store.update(standupsKey, &standups, func() error {
+			delete(standups, channel)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		return "No more standups here", nil
+
+	default:
+		return usage, nil
+	}
+
+	standups := make(map[string]*standup)
+	err := s.store.update(standupsKey, &standups, func() error {
+		su := standups[channel]
+		if su == nil {
+			su = &standup{Channel: channel}
+			standups[channel] = su
+		}
+		change(su)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if standups[channel].Time == "" {
+		reply += ", now tell me when with standup at 9:30am"
+	}
+	return reply, nil
+}
+
+func (s *server) showStandup(channel string) (string, error) {
+	standups := make(map[string]*standup)
+	err := s.store.load(standupsKey, &standups)
+	if err != nil {
+		return "", err
+	}
+	su := standups[channel]
+	if su == nil || su.Time == "" {
+		return "There's no standup here yet, try standup at 9:30am", nil
+	}
+
+	var r strings.Builder
+	r.WriteString("Standup is at " + su.Time + " " + su.location().String() + " on weekdays, the answers get posted ")
+	if su.Summary == "" {
+		r.WriteString("an hour later\n")
+	} else {
+		r.WriteString("at " + su.Summary + "\n")
+	}
+	if len(su.Members) == 0 {
+		r.WriteString("Everyone in the channel gets asked:\n")
+	} else {
+		var members []string
+		for _, m := range su.Members {
+			members = append(members, "<@"+m+">")
+		}
+		r.WriteString(strings.Join(members, ", ") + " get asked:\n")
+	}
+	r.WriteString(strings.Join(su.questions(), "\n"))
+	return r.String(), nil
+}
+
+// standupMembers is who gets asked, leaving out bots and anyone who has
+// opted out of DMs
+func (s *server) standupMembers(su *standup) ([]string, error) {
+	ids := su.Members
+	if len(ids) == 0 {
+		members, err := s.conversationMembers(su.Channel)
+		if err != nil {
+			return nil, err
+		}
+		ids = members
+	}
+	people, err := s.people(ids)
+	if err != nil {
+		return nil, err
+	}
+	optOuts := make(map[string]bool)
+	err = s.store.load(dmOptOutsKey, &optOuts)
+	if err != nil {
+		return nil, err
+	}
+	var asking []string
+	for _, u := range people {
+		if !optOuts[u.ID] {
+			asking = append(asking, u.ID)
+		}
+	}
+	return asking, nil
+}
+
+// startStandup DMs asking the first question, and returns who it DMed.
+// There's only ever one standup going in a channel
+func (s *server) startStandup(su *standup, asking []string, now time.Time) (string, []string, error) {
+	runs := make(map[string]*standupRun)
+	err := s.store.load(standupRunsKey, &runs)
+	if err != nil {
+		return "", nil, err
+	}
+	if r := runs[su.Channel]; r != nil {
+		return r.inProgress(), nil, nil
+	}
+	if len(asking) == 0 {
+		return "There's nobody here to ask", nil, nil
+	}
+
+	run := &standupRun{
+		Channel:   su.Channel,
+		Timezone:  su.location().String(),
+		Questions: su.questions(),
+		Started:   now,
+		Due:       su.summaryTime(now),
+		IMs:       make(map[string]string),
+		Answers:   make(map[string][]string),
+	}
+	for _, user := range asking {
+		_, _, c, err := s.slack.OpenIMChannel(user)
+		if err != nil {
+			fmt.Printf("Error: Could not open an IM channel to: %s: %s\n", user, err)
+			continue
+		}
+		run.Members = append(run.Members, user)
+		run.IMs[user] = c
+		s.slack.SendMessage(s.slack.NewOutgoingMessage(fmt.Sprintf("It's standup time for <#%s>! I'll post your answers there at %s\n%s",
+			su.Channel, run.clock(run.Due), run.Questions[0]), c))
+	}
+
+	var existing *standupRun
+	err = s.store.update(standupRunsKey, &runs, func() error {
+		// in case the scheduled one started while we were asking
+		if existing = runs[su.Channel]; existing == nil {
+			runs[su.Channel] = run
+		}
+		return nil
+	})
+	if err != nil {
+		return "", run.Members, err
+	}
+	if existing != nil {
+		return existing.inProgress(), run.Members, nil
+	}
+	return "I've asked " + personCount(len(run.Members)) + ", answers at " + run.clock(run.Due), run.Members, nil
+}
+
+func (r *standupRun) inProgress() string {
+	return "Standup is already going, I'll post the answers at " + r.clock(r.Due)
+}
+
+// standupAnswer records a DM as the answer to someone's current standup
+// question, and returns the next question. It returns false when they
+// aren't in the middle of a standup
+func (s *server) standupAnswer(user, channel, text string) (string, bool, error) {
+	var reply string
+	answered := false
+	runs := make(map[string]*standupRun)
+	err := s.store.update(standupRunsKey, &runs, func() error {
+		// when someone is in more than one standup, answer the oldest first
+		var waiting []*standupRun
+		for _, r := range runs {
+			if r.waitingOn(user) && r.IMs[user] == channel {
+				waiting = append(waiting, r)
+			}
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		sort.Slice(waiting, func(i, j int) bool { return waiting[i].Started.Before(waiting[j].Started) })
+
+		r := waiting[0]
+		answered = true
+		r.Answers[user] = append(r.Answers[user], strings.TrimSpace(text))
+		if r.waitingOn(user) {
+			reply = r.Questions[len(r.Answers[user])]
+			return nil
+		}
+		reply = "Thanks! That's all for <#" + r.Channel + ">"
+		if len(waiting) > 1 {
+			next := waiting[1]
+			reply += "\nNow for <#" + next.Channel + ">: " + next.Questions[len(next.Answers[user])]
+		}
+		return nil
+	})
+	return reply, answered, err
+}
+
+// runStandups starts any standups that are due, nudges anyone who hasn't
+// answered halfway through, and posts the answers when time is up
+func (s *server) runStandups(now time.Time) error {
+	standups := make(map[string]*standup)
+	err := s.store.load(standupsKey, &standups)
+	if err != nil {
+		return err
+	}
+	runs := make(map[string]*standupRun)
+	err = s.store.load(standupRunsKey, &runs)
+	if err != nil {
+		return err
+	}
+
+	for channel, su := range standups {
+		local := now.In(su.location())
+		if su.Time == "" || local.Weekday() == time.Saturday || local.Weekday() == time.Sunday || local.Format("15:04") != su.Time {
+			continue
+		}
+		if runs[channel] != nil {
+			continue
+		}
+		asking, err := s.standupMembers(su)
+		if err != nil {
+			fmt.Printf("Error: Could not start standup for %s: %s\n", channel, err)
+			continue
+		}
+		_, dmed, err := s.startStandup(su, asking, now)
+		if err != nil {
+			fmt.Printf("Error: Could not start standup for %s: %s\n", channel, err)
+		}
+		// nobody asked for these, so they're down to the channel
+		if err := s.auditDMs(channel, "standup", dmed, now); err != nil {
+			fmt.Printf("Error: %s\n", err)
+		}
+	}
+
+	// people can opt out of DMs halfway through a standup too
+	optOuts := make(map[string]bool)
+	err = s.store.load(dmOptOutsKey, &optOuts)
+	if err != nil {
+		return err
+	}
+
+	var summaries []*standupRun
+	err = s.store.update(standupRunsKey, &runs, func() error {
+		for channel, r := range runs {
+			if !now.Before(r.Due) {
+				summaries = append(summaries, r)
+				delete(runs, channel)
+				continue
+			}
+			if !r.Nudged && !now.Before(r.Started.Add(r.Due.Sub(r.Started)/2)) {
+				r.Nudged = true
+				for _, m := range r.Members {
+					if r.waitingOn(m) && !optOuts[m] {
+						s.slack.SendMessage(s.slack.NewOutgoingMessage(fmt.Sprintf("Don't forget standup for <#%s>, I'm posting the answers at %s\n%s",
+							r.Channel, r.clock(r.Due), r.Questions[len(r.Answers[m])]), r.IMs[m]))
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range summaries {
+		s.slack.SendMessage(s.slack.NewOutgoingMessage(r.summary(), r.Channel))
+	}
+	return nil
+}
+
+// summary is everyone's answers, and who didn't answer
+func (r *standupRun) summary() string {
+	var b strings.Builder
+	b.WriteString(":memo: Standup for " + r.Started.In(loadLocation(r.Timezone)).Format("Monday 2 January") + "\n")
+	var missing []string
+	for _, m := range r.Members {
+		answers := r.Answers[m]
+		if len(answers) == 0 {
+			missing = append(missing, "<@"+m+">")
+			continue
+		}
+		b.WriteString("\n<@" + m + ">\n")
+		for i, a := range answers {
+			b.WriteString("*" + r.Questions[i] + "*\n" + a + "\n")
+		}
+	}
+	if len(missing) > 0 {
+		b.WriteString("\nNo update from " + strings.Join(missing, ", "))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func personCount(n int) string {
+	if n == 1 {
+		return "1 person"
+	}
+	return fmt.Sprintf("%d people", n)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// store - json documents for the things rudolph has to remember, one file
+// per key in dir, or just in memory when there is no dir
+type store struct {
+	dir string
+	mu  sync.Mutex
+	mem map[string][]byte
+}
+
+func newStore(dir string) *store {
+	return &store{dir: dir, mem: make(map[string][]byte)}
+}
+
+// load leaves v alone if nothing has been saved under key yet
+func (s *store) load(key string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(key, v)
+}
+
+func (s *store) save(key string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(key, v)
+}
+
+// update loads key into v, lets change modify it and saves it, without
+// anyone else getting in between
+func (s *store) update(key string, v interface{}, change func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.read(key, v)
+	if err != nil {
+		return err
+	}
+	err = change()
+	if err != nil {
+		return err
+	}
+	return s.write(key, v)
+}
+
+func (s *store) read(key string, v interface{}) error {
+	var data []byte
+	if s.dir == "" {
+		data = s.mem[key]
+	} else {
+		d, err := ioutil.ReadFile(s.path(key))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Could not read %s", key)
+		}
+		data = d
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return errors.Wrapf(err, "Could not deserialise %s", key)
+	}
+	return nil
+}
+
+func (s *store) write(key string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "Could not serialise %s", key)
+	}
+
+	if s.dir == "" {
+		s.mem[key] = data
+		return nil
+	}
+
+	err = os.MkdirAll(s.dir, 0755)
+	if err != nil {
+		return errors.Wrapf(err, "Could not create %s", s.dir)
+	}
+	// write to a temp file first so a crash can't leave half a file behind
+	tmp := s.path(key) + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Could not write %s", key)
+	}
+	return os.Rename(tmp, s.path(key))
+}
+
+func (s *store) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
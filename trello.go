@@ -1,13 +1,19 @@
 package main
 
 import (
+	"time"
+
 	"github.com/adlio/trello"
+	"github.com/pkg/errors"
 )
 
 // TrelloClient - for mocking trello client
 type TrelloClient interface {
 	CreateCard(card *trello.Card, extraArgs trello.Arguments) error
 	GetList(listID string, args trello.Arguments) (list *trello.List, err error)
+	GetCard(cardID string, args trello.Arguments) (card *trello.Card, err error)
+	CreateWebhook(webhook *trello.Webhook) error
+	GetToken(tokenID string, args trello.Arguments) (token *trello.Token, err error)
 }
 
 func newTrelloClient(appKey, token string) TrelloClient {
@@ -28,3 +34,111 @@ func getCards(client TrelloClient, listID string) ([]*trello.Card, error) {
 
 	return cards, nil
 }
+
+var trelloLists = map[string]string{
+	ideasList:     ideasListID,
+	scheduledList: scheduledListID,
+	meetupsList:   meetupsListID,
+}
+
+// trelloBacklog - the backlog on our trello board, reads go through the cache when there is one
+type trelloBacklog struct {
+	client TrelloClient
+	cache  *listCache
+}
+
+func (t *trelloBacklog) Items(list string) ([]backlogItem, error) {
+	listID, err := trelloListID(list)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []*trello.Card
+	if t.cache == nil {
+		cards, err = getCards(t.client, listID)
+	} else {
+		cards, err = t.cache.getCards(listID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]backlogItem, 0, len(cards))
+	for _, c := range cards {
+		items = append(items, backlogItem{
+			ID:          c.ID,
+			List:        list,
+			Title:       c.Name,
+			Description: c.Desc,
+			URL:         c.Url,
+			Due:         c.Due,
+		})
+	}
+	return items, nil
+}
+
+func (t *trelloBacklog) Create(list string, item *backlogItem) error {
+	listID, err := trelloListID(list)
+	if err != nil {
+		return err
+	}
+
+	card := &trello.Card{Name: item.Title, Desc: item.Description, IDList: listID, Due: item.Due}
+	err = t.client.CreateCard(card, trello.Defaults())
+	if err != nil {
+		return err
+	}
+	t.cache.invalidate(listID)
+
+	item.ID = card.ID
+	item.List = list
+	item.URL = card.Url
+	return nil
+}
+
+func (t *trelloBacklog) Move(id, list string) error {
+	listID, err := trelloListID(list)
+	if err != nil {
+		return err
+	}
+
+	card, err := t.client.GetCard(id, trello.Defaults())
+	if err != nil {
+		return err
+	}
+
+	// moving the card changes its IDList, so remember where it came from
+	from := card.IDList
+	err = card.MoveToList(listID, trello.Defaults())
+	if err != nil {
+		return err
+	}
+	t.cache.invalidate(from, listID)
+	return nil
+}
+
+func (t *trelloBacklog) SetDue(id string, due *time.Time) error {
+	card, err := t.client.GetCard(id, trello.Defaults())
+	if err != nil {
+		return err
+	}
+
+	d := "null"
+	if due != nil {
+		d = due.Format(time.RFC3339)
+	}
+	err = card.Update(trello.Arguments{"due": d})
+	if err != nil {
+		return err
+	}
+	t.cache.invalidate(card.IDList)
+	return nil
+}
+
+func trelloListID(list string) (string, error) {
+	id, ok := trelloLists[list]
+	if !ok {
+		return "", errors.Errorf("No trello list for: %s", list)
+	}
+	return id, nil
+}
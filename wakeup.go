@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/pkg/errors"
+)
+
+const (
+	wakeUpsKey       = "wake_ups"
+	wakeUpSnoozesKey = "wake_up_snoozes"
+
+	defaultNudgeMinutes = 5
+	defaultNudges       = 3
+	defaultSnooze       = time.Hour
+)
+
+// wakeUpConfig - how long to wait for a reaction before nudging someone
+// again, and how many times
+type wakeUpConfig struct {
+	NudgeMinutes int `json:"nudge_minutes"`
+	Nudges       int `json:"nudges"`
+}
+
+func (w wakeUpConfig) interval() time.Duration {
+	if w.NudgeMinutes <= 0 {
+		return defaultNudgeMinutes * time.Minute
+	}
+	return time.Duration(w.NudgeMinutes) * time.Minute
+}
+
+func (w wakeUpConfig) nudges() int {
+	if w.Nudges <= 0 {
+		return defaultNudges
+	}
+	return w.Nudges
+}
+
+// pendingWakeUp - someone we're trying to wake up. Pings are the timestamps
+// of the DMs we've sent them, reacting to any of them means they're awake.
+// Next is when to nudge them, or to send the first ping if they were on do
+// not disturb
+type pendingWakeUp struct {
+	Target    string    `json:"target"`
+	Requester string    `json:"requester"`
+	Channel   string    `json:"channel"`
+	Reason    string    `json:"reason"`
+	IM        string    `json:"im"`
+	Pings     []string  `json:"pings"`
+	Next      time.Time `json:"next"`
+}
+
+// wakeUpNudges get more insistent the longer someone ignores us
+var wakeUpNudges = []string{
+	":alarm_clock: Still there? <@%s> is waiting on you in <#%s>",
+	":rotating_light: <@%s> really needs you in <#%s>!",
+	":rotating_light::rotating_light: WAKE UP! <@%s> is still waiting in <#%s>",
+}
+
+// wakeUp handles eg. wake up <@U123> the build is broken, it returns true
+// if they've been pinged already rather than waiting for do not disturb
+func (s *server) wakeUp(user, channel, text string, now time.Time) (string, bool, error) {
+	targets, words := parseMentions(strings.Fields(strings.TrimSpace(text)[len("wake up"):]))
+	if len(targets) != 1 {
+		return "Tell me who to wake up, eg. wake up @ruskin.dantra the build is broken", false, nil
+	}
+	target := targets[0]
+	w := &pendingWakeUp{Target: target, Requester: user, Channel: channel, Reason: strings.Join(words, " ")}
+
+	name := "<@" + target + ">"
+	if u, err := s.slack.GetUserInfo(target); err == nil {
+		name = u.RealName
+	}
+
+	snoozes := make(map[string]time.Time)
+	err := s.store.load(wakeUpSnoozesKey, &snoozes)
+	if err != nil {
+		return "", false, err
+	}
+	if until, ok := snoozes[target]; ok && now.Before(until) {
+		return "Sorry, " + name + " has snoozed wake ups until " + clockTime(until), false, nil
+	}
+
+	if until, ok := s.dndUntil(target, now); ok {
+		w.Next = until
+		err = s.addWakeUp(w)
+		if err != nil {
+			return "", false, err
+		}
+		return "Shh, " + name + " is on do not disturb until " + clockTime(until) + ", I'll ping them then", false, nil
+	}
+
+	err = s.pingWakeUp(w, now)
+	if err != nil {
+		return "", false, err
+	}
+	err = s.addWakeUp(w)
+	if err != nil {
+		return "", true, err
+	}
+	if s.isAway(target) {
+		return "I've just pinged " + name + " for you, but they look away so I won't keep at it", true, nil
+	}
+	return "I've just pinged " + name + " for you :)", true, nil
+}
+
+// pingWakeUp sends the first ping, with who's asking, where and why
+func (s *server) pingWakeUp(w *pendingWakeUp, now time.Time) error {
+	text := ":wave: Buddy stop napping at work, <@" + w.Requester + "> is looking for you in <#" + w.Channel + ">"
+	if w.Reason != "" {
+		text += ": " + w.Reason
+	}
+	text += "\nReact to this to let them know you're on it, or `snooze 30m` to stop wake ups for a bit"
+	return s.sendWakeUp(w, text, now)
+}
+
+func (s *server) sendWakeUp(w *pendingWakeUp, text string, now time.Time) error {
+	if w.IM == "" {
+		_, _, c, err := s.slack.OpenIMChannel(w.Target)
+		if err != nil {
+			return errors.Wrapf(err, "Could not open an IM channel to: %s", w.Target)
+		}
+		w.IM = c
+	}
+	_, ts, err := s.slack.PostMessage(w.IM, text, slack.PostMessageParameters{AsUser: true})
+	if err != nil {
+		return errors.Wrapf(err, "Could not wake up: %s", w.Target)
+	}
+	w.Pings = append(w.Pings, ts)
+	w.Next = now.Add(s.config.WakeUp.interval())
+	return nil
+}
+
+func (s *server) addWakeUp(w *pendingWakeUp) error {
+	var wakeUps []*pendingWakeUp
+	return s.store.update(wakeUpsKey, &wakeUps, func() error {
+		wakeUps = append(wakeUps, w)
+		return nil
+	})
+}
+
+// nudgeWakeUps pings anyone who hasn't reacted yet a bit louder, and gives
+// up once they've had all their nudges or wandered off. Every ping counts
+// towards the DM limits of whoever asked for the wake up
+func (s *server) nudgeWakeUps(now time.Time) error {
+	limits, err := s.loadDMLimits(now)
+	if err != nil {
+		return err
+	}
+
+	// slack is slow, so work out who's due and let go of the store while we
+	// ping them. nil means we've given up on that wake up
+	var wakeUps []*pendingWakeUp
+	err = s.store.load(wakeUpsKey, &wakeUps)
+	if err != nil {
+		return err
+	}
+	results := make(map[string]*pendingWakeUp)
+	var pinged []*pendingWakeUp
+	for _, w := range wakeUps {
+		if now.Before(w.Next) {
+			continue
+		}
+		key := w.key()
+		results[key] = w
+		if until, ok := s.dndUntil(w.Target, now); ok {
+			w.Next = until
+			continue
+		}
+
+		nudge := len(w.Pings) - 1
+		if nudge >= s.config.WakeUp.nudges() || (nudge >= 0 && s.isAway(w.Target)) {
+			s.sendDM(w.Requester, fmt.Sprintf("<@%s> hasn't answered after %d %s, you might have to go and find them", w.Target, len(w.Pings), plural(len(w.Pings), "ping")))
+			results[key] = nil
+			continue
+		}
+		if refusal := limits.refuse(w.Requester, []string{w.Target}, s.config.DMs); refusal != "" {
+			s.sendDM(w.Requester, "I've stopped pinging <@"+w.Target+">: "+refusal)
+			results[key] = nil
+			continue
+		}
+
+		var pingErr error
+		if nudge < 0 {
+			// they've just come off do not disturb
+			pingErr = s.pingWakeUp(w, now)
+		} else {
+			if nudge >= len(wakeUpNudges) {
+				nudge = len(wakeUpNudges) - 1
+			}
+			pingErr = s.sendWakeUp(w, fmt.Sprintf(wakeUpNudges[nudge], w.Requester, w.Channel), now)
+		}
+		if pingErr != nil {
+			fmt.Printf("Error: %s\n", pingErr)
+			if len(w.Pings) == 0 {
+				results[key] = nil
+			}
+			continue
+		}
+		limits.record(w.Requester, []string{w.Target})
+		pinged = append(pinged, w)
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	// anyone who reacted in the meantime has gone, and new wake ups stay
+	var current []*pendingWakeUp
+	err = s.store.update(wakeUpsKey, &current, func() error {
+		var kept []*pendingWakeUp
+		for _, w := range current {
+			r, ok := results[w.key()]
+			if !ok {
+				kept = append(kept, w)
+			} else if r != nil {
+				kept = append(kept, r)
+			}
+		}
+		current = kept
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, w := range pinged {
+		if err := s.auditDMs(w.Requester, "wake up", []string{w.Target}, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// key tells a wake up apart from the others, as it was stored
+func (w *pendingWakeUp) key() string {
+	return w.Target + " " + w.Requester + " " + w.Channel + " " + w.Next.String() + " " + strings.Join(w.Pings, ",")
+}
+
+// ackWakeUp stops the pings when someone reacts to one, and lets whoever
+// was looking for them know
+func (s *server) ackWakeUp(user, ts string) error {
+	var woken []*pendingWakeUp
+	var wakeUps []*pendingWakeUp
+	err := s.store.update(wakeUpsKey, &wakeUps, func() error {
+		var kept []*pendingWakeUp
+		for _, w := range wakeUps {
+			if w.Target == user && contains(w.Pings, ts) {
+				woken = append(woken, w)
+				continue
+			}
+			kept = append(kept, w)
+		}
+		wakeUps = kept
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, w := range woken {
+		s.sendDM(w.Requester, "<@"+w.Target+"> is awake and on it :)")
+	}
+	return nil
+}
+
+// snoozeDuration is the 30m in eg. snooze wake ups for 30m
+func snoozeDuration(text string) string {
+	d := strings.TrimSpace(strings.TrimPrefix(text, "snooze"))
+	d = strings.TrimSpace(strings.TrimPrefix(d, "wake ups"))
+	return strings.TrimSpace(strings.TrimPrefix(d, "for"))
+}
+
+// isSnoozeReply is whether a DM is just snooze, snooze 30m, snooze wake ups
+// for 2h or unsnooze, rather than something else that starts with snooze
+func isSnoozeReply(text string) bool {
+	if text == "unsnooze" {
+		return true
+	}
+	if text != "snooze" && !strings.HasPrefix(text, "snooze ") {
+		return false
+	}
+	d := snoozeDuration(text)
+	if d == "" {
+		return true
+	}
+	snooze, err := time.ParseDuration(strings.Replace(d, " ", "", -1))
+	return err == nil && snooze > 0
+}
+
+// snoozeWakeUps handles eg. snooze 30m, snooze wake ups for 2h and unsnooze
+func (s *server) snoozeWakeUps(user, text string, now time.Time) (string, error) {
+	until := time.Time{}
+	if strings.HasPrefix(text, "snooze") {
+		d := snoozeDuration(text)
+		snooze := defaultSnooze
+		if d != "" {
+			var err error
+			snooze, err = time.ParseDuration(strings.Replace(d, " ", "", -1))
+			if err != nil || snooze <= 0 {
+				return "I don't know how long " + d + " is, try something like snooze 30m or snooze 2h", nil
+			}
+		}
+		until = now.Add(snooze)
+	}
+
+	snoozes := make(map[string]time.Time)
+	err := s.store.update(wakeUpSnoozesKey, &snoozes, func() error {
+		if until.IsZero() {
+			delete(snoozes, user)
+		} else {
+			snoozes[user] = until
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if until.IsZero() {
+		return "Wake ups are back on", nil
+	}
+
+	// and stop any that are already going
+	var cancelled []*pendingWakeUp
+	var wakeUps []*pendingWakeUp
+	err = s.store.update(wakeUpsKey, &wakeUps, func() error {
+		var kept []*pendingWakeUp
+		for _, w := range wakeUps {
+			if w.Target == user {
+				cancelled = append(cancelled, w)
+				continue
+			}
+			kept = append(kept, w)
+		}
+		wakeUps = kept
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, w := range cancelled {
+		s.sendDM(w.Requester, "<@"+user+"> has snoozed wake ups until "+clockTime(until))
+	}
+	return "No more wake ups until " + clockTime(until) + ", unsnooze to turn them back on", nil
+}
+
+// dndUntil is when someone's do not disturb or snooze ends, if they're on it
+func (s *server) dndUntil(user string, now time.Time) (time.Time, bool) {
+	dnd, err := s.slack.GetDNDInfo(&user)
+	if err != nil {
+		fmt.Printf("Error: Could not get do not disturb for %s: %s\n", user, err)
+		return time.Time{}, false
+	}
+	var until time.Time
+	if dnd.SnoozeEnabled && int64(dnd.SnoozeEndTime) > now.Unix() {
+		until = time.Unix(int64(dnd.SnoozeEndTime), 0)
+	}
+	if dnd.Enabled && int64(dnd.NextStartTimestamp) <= now.Unix() && int64(dnd.NextEndTimestamp) > now.Unix() {
+		if end := time.Unix(int64(dnd.NextEndTimestamp), 0); end.After(until) {
+			until = end
+		}
+	}
+	return until, !until.IsZero()
+}
+
+func (s *server) isAway(user string) bool {
+	p, err := s.slack.GetUserPresence(user)
+	if err != nil {
+		fmt.Printf("Error: Could not get presence for %s: %s\n", user, err)
+		return false
+	}
+	return p.Presence == "away"
+}
+
+// clockTime is eg. 3:04pm in New Zealand
+func clockTime(t time.Time) string {
+	return t.In(loadLocation("Pacific/Auckland")).Format("3:04pm")
+}
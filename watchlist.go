@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const watchlistsKey = "watchlists"
+
+// updates go out when the exchanges open and close until someone picks
+// their own times
+var (
+	defaultWatchTimes    = []string{"open", "close"}
+	defaultWatchTimezone = "Pacific/Auckland"
+)
+
+// watchlist - the shares someone wants updates on, and when. Times are
+// HH:MM in Timezone, or open or close for when the share's exchange does
+type watchlist struct {
+	Symbols  []string `json:"symbols"`
+	Times    []string `json:"times,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+}
+
+func (w *watchlist) times() []string {
+	if len(w.Times) == 0 {
+		return defaultWatchTimes
+	}
+	return w.Times
+}
+
+func (w *watchlist) timezone() string {
+	if w.Timezone == "" {
+		return defaultWatchTimezone
+	}
+	return w.Timezone
+}
+
+// watch adds a share to someone's watchlist, eg. watch atm nzx
+func (s *server) watch(user, text string) (string, error) {
+	symbol := strings.TrimSpace(strings.TrimPrefix(text, "watch"))
+	if symbol == "" {
+		return "Tell me what to watch, eg. watch atm nzx", nil
+	}
+	q, err := s.quotes.Quote(symbol)
+	if isSymbolNotFound(err) {
+		return "I couldn't find a share called " + symbol + ", try something like watch atm nzx", nil
+	}
+	if isBadSymbol(err) {
+		return err.Error() + ", try something like watch atm nzx", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	lists := make(map[string]*watchlist)
+	err = s.store.update(watchlistsKey, &lists, func() error {
+		w, ok := lists[user]
+		if !ok {
+			w = &watchlist{}
+			lists[user] = w
+		}
+		for _, sym := range w.Symbols {
+			if sym == symbol {
+				return nil
+			}
+		}
+		w.Symbols = append(w.Symbols, symbol)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "I'll keep you posted on " + q.String(), nil
+}
+
+// unwatch takes a share off someone's watchlist, eg. unwatch atm nzx
+func (s *server) unwatch(user, text string) (string, error) {
+	symbol := strings.TrimSpace(strings.TrimPrefix(text, "unwatch"))
+
+	found := false
+	lists := make(map[string]*watchlist)
+	err := s.store.update(watchlistsKey, &lists, func() error {
+		w, ok := lists[user]
+		if !ok {
+			return nil
+		}
+		found = len(w.Symbols) != len(removeString(w.Symbols, symbol))
+		w.Symbols = removeString(w.Symbols, symbol)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "You weren't watching " + symbol, nil
+	}
+	return "No more updates on " + symbol + " for you", nil
+}
+
+// watchlistCommand handles eg.
+//
+//	my watchlist
+//	watchlist times 9:30am 4pm
+//	watchlist timezone Australia/Sydney
+func (s *server) watchlistCommand(user, text string) (string, error) {
+	original := strings.Fields(text)
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) > 0 && words[0] == "my" {
+		original, words = original[1:], words[1:]
+	}
+	original, words = original[1:], words[1:]
+	lists := make(map[string]*watchlist)
+
+	if len(words) == 0 {
+		err := s.store.load(watchlistsKey, &lists)
+		if err != nil {
+			return "", err
+		}
+		w, ok := lists[user]
+		if !ok || len(w.Symbols) == 0 {
+			return "You aren't watching anything, try watch atm nzx", nil
+		}
+		update, err := getScheduledUpdate(s.quotes, w.Symbols)
+		if err != nil {
+			return "", err
+		}
+		return update + "Updates at " + strings.Join(w.times(), ", ") + " " + w.timezone() + " on trading days", nil
+	}
+
+	var reply string
+	var change func(w *watchlist)
+	switch words[0] {
+	case "times", "at":
+		var times []string
+		for _, t := range words[1:] {
+			if t == "open" || t == "close" {
+				times = append(times, t)
+				continue
+			}
+			hm, ok := parseClockTime(t)
+			if !ok {
+				return "I don't know what time " + t + " is, try something like open, close, 9:30am or 16:00", nil
+			}
+			times = append(times, hm)
+		}
+		if len(times) == 0 {
+			return "Tell me when, eg. watchlist times 9:30am 4pm", nil
+		}
+		sort.Strings(times)
+		reply = "You'll get updates at " + strings.Join(times, ", ")
+		change = func(w *watchlist) { w.Times = times }
+
+	case "timezone":
+		if len(words) != 2 {
+			return "Tell me which timezone, eg. watchlist timezone Australia/Sydney", nil
+		}
+		// timezones are case sensitive
+		tz := original[1]
+		if _, err := time.LoadLocation(tz); err != nil {
+			return "I don't know the timezone " + tz + ", try something like Australia/Sydney", nil
+		}
+		reply = "You'll get updates in " + tz + " time"
+		change = func(w *watchlist) { w.Timezone = tz }
+
+	default:
+		return "Try my watchlist, watchlist times 9:30am 4pm or watchlist timezone Australia/Sydney", nil
+	}
+
+	err := s.store.update(watchlistsKey, &lists, func() error {
+		w, ok := lists[user]
+		if !ok {
+			w = &watchlist{}
+			lists[user] = w
+		}
+		change(w)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return reply, nil
+}
+
+// sendWatchlistUpdates DMs everyone whose update is due
+func (s *server) sendWatchlistUpdates(clock clock) error {
+	lists := make(map[string]*watchlist)
+	err := s.store.load(watchlistsKey, &lists)
+	if err != nil {
+		return err
+	}
+
+	for user, w := range lists {
+		due := sharesDue(clock, w)
+		if len(due) == 0 {
+			continue
+		}
+		update, err := getScheduledUpdate(s.quotes, due)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			continue
+		}
+		if update == "" {
+			// we couldn't get any of their prices
+			continue
+		}
+		s.sendDM(user, update)
+	}
+	return nil
+}
+
+// parseClockTime turns eg. 9:30am, 4pm or 16:00 into 15:04 form
+func parseClockTime(t string) (string, bool) {
+	t = strings.ToLower(t)
+	pm := strings.HasSuffix(t, "pm")
+	am := strings.HasSuffix(t, "am")
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "pm"), "am")
+
+	parts := strings.SplitN(t, ":", 2)
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return "", false
+	}
+	m := 0
+	if len(parts) == 2 {
+		m, err = strconv.Atoi(parts[1])
+		if err != nil || len(parts[1]) != 2 {
+			return "", false
+		}
+	} else if !am && !pm {
+		return "", false
+	}
+
+	if (am || pm) && (h < 1 || h > 12) {
+		return "", false
+	}
+	if pm && h != 12 {
+		h += 12
+	}
+	if am && h == 12 {
+		h = 0
+	}
+	if h > 23 || m > 59 {
+		return "", false
+	}
+	return fmt.Sprintf("%02d:%02d", h, m), true
+}
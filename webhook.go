@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/adlio/trello"
+	"github.com/pkg/errors"
+)
+
+// webhookConfig - which board we want trello webhooks for and how we verify
+// them. Webhooks belong to the token, so we look there for ones we've made
+type webhookConfig struct {
+	boardID     string
+	secret      string
+	callbackURL string
+	token       string
+}
+
+type webhookCard struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	ShortLink string     `json:"shortLink"`
+	Due       *time.Time `json:"due"`
+	Closed    bool       `json:"closed"`
+}
+
+type webhookList struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// webhookAction is the part of a trello webhook payload we care about.
+// Old is kept raw so we can tell which fields an update actually changed,
+// trello.Action can't distinguish a cleared due date from an untouched one.
+type webhookAction struct {
+	Type string `json:"type"`
+	Data struct {
+		Card       webhookCard                `json:"card"`
+		List       *webhookList               `json:"list"`
+		ListBefore *webhookList               `json:"listBefore"`
+		ListAfter  *webhookList               `json:"listAfter"`
+		Old        map[string]json.RawMessage `json:"old"`
+	} `json:"data"`
+}
+
+type webhookPayload struct {
+	Action webhookAction `json:"action"`
+}
+
+// registerTrelloWebhook creates the webhook unless an earlier run already
+// did, trello keeps them until they're deleted
+func (s *server) registerTrelloWebhook() error {
+	token, err := s.trello.GetToken(s.webhook.token, trello.Defaults())
+	if err != nil {
+		return errors.Wrap(err, "Could not get trello token")
+	}
+	webhooks, err := token.GetWebhooks(trello.Defaults())
+	if err != nil {
+		return errors.Wrap(err, "Could not get trello webhooks")
+	}
+	for _, w := range webhooks {
+		if w.IDModel == s.webhook.boardID && w.CallbackURL == s.webhook.callbackURL {
+			return nil
+		}
+	}
+
+	err = s.trello.CreateWebhook(&trello.Webhook{
+		IDModel:     s.webhook.boardID,
+		Description: "rudolph",
+		CallbackURL: s.webhook.callbackURL,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Could not register trello webhook for board: %s", s.webhook.boardID)
+	}
+	return nil
+}
+
+func (s *server) handleTrelloWebhook(w http.ResponseWriter, r *http.Request) {
+	// trello sends a HEAD when the webhook is created to check we exist
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !verifyTrelloSignature(body, s.webhook.callbackURL, s.webhook.secret, r.Header.Get("X-Trello-Webhook")) {
+		fmt.Println("Error: trello webhook signature did not match")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var p webhookPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		fmt.Printf("Error: Could not deserialise trello webhook: %s\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.cache.invalidate(changedLists(p.Action)...)
+
+	if msg := announcement(p.Action); msg != "" {
+		s.slack.SendMessage(s.slack.NewOutgoingMessage(msg, teamChannelID))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// trello signs base64(HMAC-SHA1(secret, body + callbackURL))
+func verifyTrelloSignature(body []byte, callbackURL, secret, signature string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	mac.Write([]byte(callbackURL))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// changedLists returns the lists an action touched, or nothing if we can't
+// tell, in which case everything should be refetched
+func changedLists(a webhookAction) []string {
+	var ids []string
+	for _, l := range []*webhookList{a.Data.List, a.Data.ListBefore, a.Data.ListAfter} {
+		if l != nil && l.ID != "" {
+			ids = append(ids, l.ID)
+		}
+	}
+	return ids
+}
+
+func announcement(a webhookAction) string {
+	card := a.Data.Card
+
+	switch a.Type {
+	case "createCard":
+		if a.Data.List != nil && a.Data.List.ID == scheduledListID {
+			return "New talk scheduled: " + card.Name + dueSuffix(card.Due)
+		}
+
+	case "updateCard":
+		if a.Data.ListAfter != nil && a.Data.ListAfter.ID == scheduledListID {
+			return "New talk scheduled: " + card.Name + dueSuffix(card.Due)
+		}
+		// everything else only matters for talks that are scheduled
+		if a.Data.List == nil || a.Data.List.ID != scheduledListID {
+			return ""
+		}
+		if _, ok := a.Data.Old["closed"]; ok && card.Closed {
+			return card.Name + " has been archived"
+		}
+		if _, ok := a.Data.Old["due"]; ok {
+			if card.Due == nil {
+				return card.Name + " no longer has a date"
+			}
+			return card.Name + " has moved to " + formatDue(*card.Due)
+		}
+	}
+	return ""
+}
+
+func dueSuffix(due *time.Time) string {
+	if due == nil {
+		return ""
+	}
+	return " on " + formatDue(*due)
+}
+
+func formatDue(t time.Time) string {
+	return t.In(loadLocation("Pacific/Auckland")).Format("Mon 2 Jan 3:04pm")
+}